@@ -9,6 +9,9 @@ import (
 
 	pb "github.com/tokopedia/gripmock/protogen/example/stream"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func main() {
@@ -34,6 +37,21 @@ func main() {
 	wg.Add(1)
 	go bidirectionalStream(c, wg)
 
+	wg.Add(1)
+	go serverStreamDelays(c, wg)
+
+	wg.Add(1)
+	go serverStreamErrorDetails(c, wg)
+
+	wg.Add(1)
+	go periodicStream(c, wg)
+
+	wg.Add(1)
+	go clientStreamCount(c, wg)
+
+	wg.Add(1)
+	go conversation(c, wg)
+
 	wg.Wait()
 
 }
@@ -129,3 +147,186 @@ func bidirectionalStream(c pb.GripmockClient, wg *sync.WaitGroup) {
 	}
 	stream.CloseSend()
 }
+
+// receiveAll reads a server stream until it ends, and returns its messages and how it ended
+func receiveAll(stream pb.Gripmock_ServerStreamClient) ([]string, error) {
+	var messages []string
+	for {
+		reply, err := stream.Recv()
+		if err == io.EOF {
+			return messages, nil
+		}
+		if err != nil {
+			return messages, err
+		}
+		messages = append(messages, reply.Message)
+	}
+}
+
+// server to client streaming with stream delays, a response delay and trailers
+func serverStreamDelays(c pb.GripmockClient, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	start := time.Now()
+	stream, err := c.ServerStream(context.Background(), &pb.Request{Name: "stream-delay"})
+	if err != nil {
+		log.Fatalf("stream delay error: %v", err)
+	}
+	messages, err := receiveAll(stream)
+	if err != nil {
+		log.Fatalf("stream delay error: %v", err)
+	}
+	if len(messages) != 3 || messages[0] != "first" || messages[2] != "third" {
+		log.Fatalf("stream delay: unexpected messages %v", messages)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		log.Fatalf("stream delay: 3 messages 100ms apart took %v", elapsed)
+	}
+	if cursor := stream.Trailer().Get("x-cursor"); len(cursor) != 1 || cursor[0] != "3" {
+		log.Fatalf("stream delay: unexpected trailer x-cursor %v", cursor)
+	}
+	log.Printf("stream delay messages: %v, trailer x-cursor: 3", messages)
+
+	start = time.Now()
+	stream, err = c.ServerStream(context.Background(), &pb.Request{Name: "delay"})
+	if err != nil {
+		log.Fatalf("delay error: %v", err)
+	}
+	if _, err := receiveAll(stream); err != nil {
+		log.Fatalf("delay error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond {
+		log.Fatalf("delay: a 300ms delay took %v", elapsed)
+	}
+	log.Printf("delay: responded after %v", time.Since(start).Round(time.Millisecond))
+
+	// the response is delayed past the deadline of the call
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	stream, err = c.ServerStream(ctx, &pb.Request{Name: "hanging"})
+	if err != nil {
+		log.Fatalf("hanging error: %v", err)
+	}
+	if _, err := receiveAll(stream); status.Code(err) != codes.DeadlineExceeded {
+		log.Fatalf("hanging: expected DeadlineExceeded, got %v", err)
+	}
+	log.Printf("hanging: DeadlineExceeded")
+}
+
+// server to client streaming ending with an error with details
+func serverStreamErrorDetails(c pb.GripmockClient, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	stream, err := c.ServerStream(context.Background(), &pb.Request{Name: "quota"})
+	if err != nil {
+		log.Fatalf("error details error: %v", err)
+	}
+	_, err = receiveAll(stream)
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted || st.Message() != "quota exceeded" {
+		log.Fatalf("error details: unexpected status %v", err)
+	}
+	details := st.Proto().GetDetails()
+	if len(details) != 1 || details[0].GetTypeUrl() != "type.googleapis.com/google.rpc.ErrorInfo" {
+		log.Fatalf("error details: unexpected details %v", details)
+	}
+	log.Printf("error details: %s with %s", st.Code(), details[0].GetTypeUrl())
+}
+
+// periodic server streams ending after a count or a duration
+func periodicStream(c pb.GripmockClient, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	stream, err := c.ServerStream(context.Background(), &pb.Request{Name: "heartbeat"})
+	if err != nil {
+		log.Fatalf("heartbeat error: %v", err)
+	}
+	messages, err := receiveAll(stream)
+	if err != nil {
+		log.Fatalf("heartbeat error: %v", err)
+	}
+	if len(messages) != 3 || messages[0] != "beat 1" || messages[2] != "beat 3" {
+		log.Fatalf("heartbeat: unexpected messages %v", messages)
+	}
+	log.Printf("heartbeat messages: %v", messages)
+
+	start := time.Now()
+	stream, err = c.ServerStream(context.Background(), &pb.Request{Name: "ticker"})
+	if err != nil {
+		log.Fatalf("ticker error: %v", err)
+	}
+	messages, err = receiveAll(stream)
+	if status.Code(err) != codes.DeadlineExceeded || status.Convert(err).Message() != "ticker stopped" {
+		log.Fatalf("ticker: expected the stub error after max_duration, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 300*time.Millisecond || len(messages) < 2 || messages[0] != "tick" || messages[1] != "tock" {
+		log.Fatalf("ticker: unexpected messages %v in %v", messages, elapsed)
+	}
+	log.Printf("ticker: %d messages before %v", len(messages), err)
+}
+
+// client to server streaming matched on the stream as a whole
+func clientStreamCount(c pb.GripmockClient, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	stream, err := c.ClientStream(context.Background())
+	if err != nil {
+		log.Fatalf("stream count error: %v", err)
+	}
+	for _, name := range []string{"batch-1", "batch-2", "batch-3"} {
+		if err := stream.Send(&pb.Request{Name: name}); err != nil {
+			log.Fatalf("stream count error: %v", err)
+		}
+	}
+	reply, err := stream.CloseAndRecv()
+	if err != nil || reply.Message != "got 3 messages" {
+		log.Fatalf("stream count: unexpected reply %v, %v", reply, err)
+	}
+	log.Printf("stream count message: %s", reply.Message)
+
+	stream, err = c.ClientStream(context.Background())
+	if err != nil {
+		log.Fatalf("empty stream error: %v", err)
+	}
+	reply, err = stream.CloseAndRecv()
+	if err != nil || reply.Message != "no messages" {
+		log.Fatalf("empty stream: unexpected reply %v, %v", reply, err)
+	}
+	log.Printf("empty stream message: %s", reply.Message)
+}
+
+// bidirectional stream scripted by a conversation: opening message, timers, then close after two messages
+func conversation(c pb.GripmockClient, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "x-conversation", "chat", "user", "ann")
+	stream, err := c.Bidirectional(ctx)
+	if err != nil {
+		log.Fatalf("conversation error: %v", err)
+	}
+	expect := func(message string) {
+		reply, err := stream.Recv()
+		if err != nil || reply.Message != message {
+			log.Fatalf("conversation: expected %q, got %v, %v", message, reply, err)
+		}
+		log.Printf("conversation message: %s", reply.Message)
+	}
+
+	expect("welcome ann")
+	expect("tick")
+	expect("tick")
+	for _, name := range []string{"chat-1", "chat-2"} {
+		if err := stream.Send(&pb.Request{Name: name}); err != nil {
+			log.Fatalf("conversation error: %v", err)
+		}
+		expect("echo " + name)
+	}
+
+	_, err = stream.Recv()
+	if status.Code(err) != codes.FailedPrecondition || status.Convert(err).Message() != "conversation over" {
+		log.Fatalf("conversation: expected the close status, got %v", err)
+	}
+	log.Printf("conversation closed: %v", err)
+}
@@ -10,6 +10,8 @@ wait_for_gripmock.sh
 echo "======== RUNNING CLIENT ========="
 go run example/stream/client/*.go && \
  echo "======== DONE ========="
+status=$?
 
-# kill the server
-kill %1
\ No newline at end of file
+# kill the server, and fail the run when the client did
+kill %1
+exit $status
@@ -22,6 +22,11 @@ func main() {
 	adminport := flag.String("admin-port", "4771", "Port of stub admin server")
 	adminBindAddr := flag.String("admin-listen", "", "Address the admin server will bind to. Default to localhost, set to 0.0.0.0 to use from another machine")
 	stubPath := flag.String("stub", "", "Path where the stub files are (Optional)")
+	strictStubs := flag.Bool("strict-stubs", false, "Abort startup when a stub file or stub can't be loaded")
+	watch := flag.Bool("watch", false, "Reload the stubs of the files created, modified or deleted under the stub path")
+	journalMaxEntries := flag.Int("journal-max-entries", stub.DEFAULT_JOURNAL_MAX_ENTRIES, "Maximum number of requests kept in the request journal. 0 means unlimited")
+	journalMaxAge := flag.Duration("journal-max-age", 0, "Maximum age of requests kept in the request journal, e.g. 1h. 0 means unlimited")
+	seed := flag.Int64("seed", 0, "Seed of injected faults, delays and random template values, to make them reproducible. 0 means random")
 	imports := flag.String("imports", "/protobuf", "comma separated imports path. default path /protobuf is where gripmock Dockerfile install WKT protos")
 
 	if len(os.Args) == 0 {
@@ -49,13 +54,6 @@ func main() {
 		os.Mkdir(output, os.ModePerm)
 	}
 
-	// run admin stub server
-	stub.RunStubServer(stub.Options{
-		StubPath: *stubPath,
-		Port:     *adminport,
-		BindAddr: *adminBindAddr,
-	})
-
 	// parse proto files
 	protoPaths := flag.Args()
 
@@ -65,14 +63,32 @@ func main() {
 
 	importDirs := strings.Split(*imports, ",")
 
-	// generate pb.go and grpc server based on proto
+	// generate pb.go and grpc server based on proto,
+	// before loading the stubs which are validated against the protos
+	descriptorSet := output + "descriptor.pb"
 	generateProtoc(protocParam{
-		protoPath:   protoPaths,
-		adminPort:   *adminport,
-		grpcAddress: *grpcBindAddr,
-		grpcPort:    *grpcPort,
-		output:      output,
-		imports:     importDirs,
+		protoPath:     protoPaths,
+		adminPort:     *adminport,
+		grpcAddress:   *grpcBindAddr,
+		grpcPort:      *grpcPort,
+		output:        output,
+		imports:       importDirs,
+		descriptorSet: descriptorSet,
+	})
+
+	// run admin stub server
+	stub.RunStubServer(stub.Options{
+		StubPath: *stubPath,
+		Port:     *adminport,
+		BindAddr: *adminBindAddr,
+
+		JournalMaxEntries: *journalMaxEntries,
+		JournalMaxAge:     *journalMaxAge,
+
+		Seed:          *seed,
+		Watch:         *watch,
+		StrictStubs:   *strictStubs,
+		DescriptorSet: descriptorSet,
 	})
 
 	// and run
@@ -96,6 +112,9 @@ type protocParam struct {
 	grpcPort    string
 	output      string
 	imports     []string
+
+	// file where protoc writes the descriptors of the protos and their imports
+	descriptorSet string
 }
 
 func getProtodirs(protoPath string, imports []string) []string {
@@ -134,7 +153,7 @@ func generateProtoc(param protocParam) {
 	protodirs := getProtodirs(param.protoPath[0], param.imports)
 
 	// estimate args length to prevent expand
-	args := make([]string, 0, len(protodirs)+len(param.protoPath)+2)
+	args := make([]string, 0, len(protodirs)+len(param.protoPath)+4)
 	for _, dir := range protodirs {
 		args = append(args, "-I", dir)
 	}
@@ -144,6 +163,7 @@ func generateProtoc(param protocParam) {
 
 	args = append(args, param.protoPath...)
 	args = append(args, "--go_out=plugins=grpc:"+pbOutput)
+	args = append(args, "--descriptor_set_out="+param.descriptorSet, "--include_imports")
 	args = append(args, fmt.Sprintf("--gripmock_out=admin-port=%s,grpc-address=%s,grpc-port=%s:%s",
 		param.adminPort, param.grpcAddress, param.grpcPort, param.output))
 	protoc := exec.Command("protoc", args...)
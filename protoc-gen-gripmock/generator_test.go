@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	"google.golang.org/protobuf/encoding/prototext"
+)
+
+// streamProto is example/stream/stream.proto after fix_gopackage.sh
+const streamProto = `
+name: "example/stream/stream.proto"
+package: "stream"
+options { go_package: "github.com/tokopedia/gripmock/protogen/example/stream" }
+syntax: "proto3"
+message_type {
+  name: "Request"
+  field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "name" }
+}
+message_type {
+  name: "Reply"
+  field { name: "message" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "message" }
+}
+service {
+  name: "Gripmock"
+  method { name: "serverStream" input_type: ".stream.Request" output_type: ".stream.Reply" server_streaming: true }
+  method { name: "clientStream" input_type: ".stream.Request" output_type: ".stream.Reply" client_streaming: true }
+  method { name: "bidirectional" input_type: ".stream.Request" output_type: ".stream.Reply" client_streaming: true server_streaming: true }
+}
+`
+
+func TestGenerateServerCompiles(t *testing.T) {
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go is not installed")
+	}
+
+	proto := &descriptor.FileDescriptorProto{}
+	if err := prototext.Unmarshal([]byte(streamProto), proto); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	err = generateServer([]*descriptor.FileDescriptorProto{proto}, &Options{
+		writer:    buf,
+		grpcAddr:  "0.0.0.0:4770",
+		adminPort: "4771",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// built inside the gripmock module, which requires the generated protos and the server dependencies.
+	// readonly keeps the build from touching its go.mod
+	dir, err := os.MkdirTemp("..", "generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, "server.go"), buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(gobin, "build", "-mod=readonly", "-o", os.DevNull, ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("generated server doesn't compile: %v\n%s", err, out)
+	}
+}
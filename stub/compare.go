@@ -0,0 +1,174 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// comparison operators usable in the compare rule
+const (
+	opGt      = "gt"
+	opGte     = "gte"
+	opLt      = "lt"
+	opLte     = "lte"
+	opBetween = "between"
+)
+
+// comparison is a numeric condition on a single field such as {"gt": 1000}
+// or {"between": [1, 100]}. all the operators it holds must pass.
+type comparison map[string][]*big.Rat
+
+// compare matches numeric conditions at any nested path of the request.
+// like contains, fields not mentioned in expect are ignored.
+func compare(expect, actual map[string]interface{}) bool {
+	conditions, err := parseComparisons(expect)
+	if err != nil {
+		log.Printf("Error on parsing compare rule %v error:%v\n", expect, err)
+		return false
+	}
+	return find(conditions, actual, true, false, compareMatch, false)
+}
+
+// parseComparisons replaces every operator object of the expectation with a comparison.
+// plain numbers are turned into an equality check.
+func parseComparisons(expect interface{}) (interface{}, error) {
+	switch v := expect.(type) {
+	case map[string]interface{}:
+		if isComparison(v) {
+			return newComparison(v)
+		}
+
+		parsed := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			item, err := parseComparisons(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+			parsed[key] = item
+		}
+		return parsed, nil
+	case []interface{}:
+		parsed := make([]interface{}, len(v))
+		for i, value := range v {
+			item, err := parseComparisons(value)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", i, err)
+			}
+			parsed[i] = item
+		}
+		return parsed, nil
+	default:
+		number, ok := toNumber(v)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a number", v)
+		}
+		return comparison{opGte: {number}, opLte: {number}}, nil
+	}
+}
+
+func isComparison(v map[string]interface{}) bool {
+	if len(v) == 0 {
+		return false
+	}
+	for key := range v {
+		switch key {
+		case opGt, opGte, opLt, opLte, opBetween:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newComparison(v map[string]interface{}) (comparison, error) {
+	cmp := comparison{}
+	for op, operand := range v {
+		if op == opBetween {
+			bounds, ok := operand.([]interface{})
+			if !ok || len(bounds) != 2 {
+				return nil, fmt.Errorf("between expects [min, max], got %v", operand)
+			}
+			min, minOk := toNumber(bounds[0])
+			max, maxOk := toNumber(bounds[1])
+			if !minOk || !maxOk {
+				return nil, fmt.Errorf("between expects numbers, got %v", operand)
+			}
+			cmp[op] = []*big.Rat{min, max}
+			continue
+		}
+
+		number, ok := toNumber(operand)
+		if !ok {
+			return nil, fmt.Errorf("%s expects a number, got %v", op, operand)
+		}
+		cmp[op] = []*big.Rat{number}
+	}
+	return cmp, nil
+}
+
+// decimalNumber is a number as protobuf JSON writes it in a string, e.g. "-12", "1.5" or "1e3".
+// big.Rat would also read fractions and base prefixes, which aren't numbers there.
+var decimalNumber = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)([eE][+-]?\d+)?$`)
+
+// toNumber reads JSON numbers as well as the string encoded numbers
+// protobuf JSON uses for 64 bit integers.
+func toNumber(v interface{}) (*big.Rat, bool) {
+	switch n := v.(type) {
+	case float64:
+		if math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(n), true
+	case int:
+		return new(big.Rat).SetInt64(int64(n)), true
+	case int64:
+		return new(big.Rat).SetInt64(n), true
+	case json.Number:
+		return new(big.Rat).SetString(n.String())
+	case string:
+		n = strings.TrimSpace(n)
+		if !decimalNumber.MatchString(n) {
+			return nil, false
+		}
+		return new(big.Rat).SetString(n)
+	default:
+		return nil, false
+	}
+}
+
+func compareMatch(expect, actual interface{}) bool {
+	cmp, ok := expect.(comparison)
+	if !ok {
+		return false
+	}
+
+	number, ok := toNumber(actual)
+	if !ok {
+		return false
+	}
+
+	for op, operands := range cmp {
+		var pass bool
+		switch op {
+		case opGt:
+			pass = number.Cmp(operands[0]) > 0
+		case opGte:
+			pass = number.Cmp(operands[0]) >= 0
+		case opLt:
+			pass = number.Cmp(operands[0]) < 0
+		case opLte:
+			pass = number.Cmp(operands[0]) <= 0
+		case opBetween:
+			pass = number.Cmp(operands[0]) >= 0 && number.Cmp(operands[1]) <= 0
+		}
+		if !pass {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,152 @@
+package stub
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_compare(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect string
+		actual string
+		want   bool
+	}{
+		{
+			name:   "gt",
+			expect: `{"amount":{"gt":1000}}`,
+			actual: `{"amount":1500,"currency":"IDR"}`,
+			want:   true,
+		},
+		{
+			name:   "gt boundary",
+			expect: `{"amount":{"gt":1000}}`,
+			actual: `{"amount":1000}`,
+			want:   false,
+		},
+		{
+			name:   "gte and lte combined",
+			expect: `{"amount":{"gte":1000,"lte":2000}}`,
+			actual: `{"amount":2000}`,
+			want:   true,
+		},
+		{
+			name:   "lt",
+			expect: `{"amount":{"lt":0}}`,
+			actual: `{"amount":-1}`,
+			want:   true,
+		},
+		{
+			name:   "between inclusive",
+			expect: `{"page":{"page_size":{"between":[1,100]}}}`,
+			actual: `{"page":{"page_size":100,"token":"abc"}}`,
+			want:   true,
+		},
+		{
+			name:   "between out of range",
+			expect: `{"page":{"page_size":{"between":[1,100]}}}`,
+			actual: `{"page":{"page_size":101}}`,
+			want:   false,
+		},
+		{
+			name:   "string encoded int64",
+			expect: `{"id":{"gt":"9007199254740992"}}`,
+			actual: `{"id":"9007199254740993"}`,
+			want:   true,
+		},
+		{
+			name:   "plain number is equality",
+			expect: `{"count":3}`,
+			actual: `{"count":"3"}`,
+			want:   true,
+		},
+		{
+			name:   "array positions",
+			expect: `{"items":[{"qty":{"gt":1}}]}`,
+			actual: `{"items":[{"qty":2},{"qty":0}]}`,
+			want:   true,
+		},
+		{
+			name:   "missing field",
+			expect: `{"amount":{"gt":1}}`,
+			actual: `{"currency":"IDR"}`,
+			want:   false,
+		},
+		{
+			name:   "not a number",
+			expect: `{"amount":{"gt":1}}`,
+			actual: `{"amount":"lots"}`,
+			want:   false,
+		},
+		{
+			name:   "string encoded float",
+			expect: `{"amount":{"gt":1}}`,
+			actual: `{"amount":"1.5e1"}`,
+			want:   true,
+		},
+		{
+			name:   "fraction string",
+			expect: `{"amount":{"gt":1}}`,
+			actual: `{"amount":"3/2"}`,
+			want:   false,
+		},
+		{
+			name:   "hex string",
+			expect: `{"amount":{"gt":1}}`,
+			actual: `{"amount":"0x10"}`,
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var expect, actual map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(tt.expect), &expect))
+			require.NoError(t, json.Unmarshal([]byte(tt.actual), &actual))
+			assert.Equal(t, tt.want, compare(expect, actual))
+		})
+	}
+}
+
+func Test_parseComparisons(t *testing.T) {
+	invalid := []string{
+		`{"amount":{"gt":"many"}}`,
+		`{"amount":{"gt":"0x10"}}`,
+		`{"amount":{"between":[1]}}`,
+		`{"amount":"many"}`,
+	}
+	for _, expect := range invalid {
+		var v map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(expect), &v))
+		_, err := parseComparisons(v)
+		assert.Error(t, err, expect)
+	}
+}
+
+func Test_findStubCompare(t *testing.T) {
+	clearStorage()
+	require.NoError(t, storeStub(&Stub{
+		Service: "Payments",
+		Method:  "Charge",
+		Input:   Input{Compare: map[string]interface{}{"amount": map[string]interface{}{"gt": float64(1000)}}},
+		Output:  Output{Data: map[string]interface{}{"review": true}},
+	}))
+
+	got, err := findStub(&findStubPayload{
+		Service: "Payments",
+		Method:  "Charge",
+		Data:    map[string]interface{}{"amount": "5000"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, true, got.Data["review"])
+
+	_, err = findStub(&findStubPayload{
+		Service: "Payments",
+		Method:  "Charge",
+		Data:    map[string]interface{}{"amount": "500"},
+	})
+	assert.Error(t, err)
+}
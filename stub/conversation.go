@@ -0,0 +1,65 @@
+package stub
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+)
+
+// EventOpen is sent by bidirectional streams when they open,
+// to look for the stub scripting their conversation
+const EventOpen = "open"
+
+// Conversation scripts a bidirectional stream beyond replying to each message.
+// the stub holding it answers the opening of the stream: its output stream is
+// sent first, before the client sends anything.
+type Conversation struct {
+	// Timers send messages on their own schedule while the stream is open
+	Timers []Timer `json:"timers,omitempty"`
+
+	// CloseAfter ends the stream with CloseCode and CloseError once the client
+	// sent that many messages. 0 means the client ends the stream.
+	CloseAfter int         `json:"close_after,omitempty"`
+	CloseCode  *codes.Code `json:"close_code,omitempty"`
+	CloseError string      `json:"close_error,omitempty"`
+}
+
+// Timer sends Data After the stream opened, then Every interval if set,
+// at most Count times when set.
+type Timer struct {
+	After Duration               `json:"after,omitempty"`
+	Every Duration               `json:"every,omitempty"`
+	Count int                    `json:"count,omitempty"`
+	Data  map[string]interface{} `json:"data"`
+}
+
+func (c Conversation) validate() error {
+	for i, timer := range c.Timers {
+		if timer.After < 0 || timer.Every < 0 || timer.Count < 0 {
+			return fmt.Errorf("timers[%d]: after, every and count can't be negative", i)
+		}
+		if timer.Data == nil {
+			return fmt.Errorf("timers[%d]: data can't be empty", i)
+		}
+	}
+	if c.CloseAfter < 0 {
+		return fmt.Errorf("close_after can't be negative")
+	}
+	return nil
+}
+
+// render returns a copy of the conversation with the templates of its timers
+// executed against the opening request. caller must hold mx.
+func (c *Conversation) render(stub *findStubPayload) (*Conversation, error) {
+	rendered := *c
+	rendered.Timers = make([]Timer, len(c.Timers))
+	for i, timer := range c.Timers {
+		output, err := renderOutput(&Output{Data: timer.Data}, stub)
+		if err != nil {
+			return nil, fmt.Errorf("timers[%d]: %v", i, err)
+		}
+		timer.Data = output.Data
+		rendered.Timers[i] = timer
+	}
+	return &rendered, nil
+}
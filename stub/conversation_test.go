@@ -0,0 +1,77 @@
+package stub
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_findStubConversation(t *testing.T) {
+	clearStorage()
+	require.NoError(t, storeStub(&Stub{
+		Service: "Chat",
+		Method:  "Talk",
+		Input:   Input{Contains: map[string]interface{}{"text": "hi"}},
+		Output:  Output{Data: map[string]interface{}{"text": "hello"}},
+	}))
+
+	// without a conversation, the opening gets an empty response and isn't recorded
+	got, err := findStub(&findStubPayload{Service: "Chat", Method: "Talk", Event: EventOpen})
+	require.NoError(t, err)
+	assert.Equal(t, &Output{}, got)
+	assert.Empty(t, allRequests(requestFilter{}))
+
+	conversation := &Conversation{
+		Timers:     []Timer{{Every: Duration(time.Second), Data: map[string]interface{}{"text": "ping {{ .Headers.user }}"}}},
+		CloseAfter: 2,
+	}
+	stub := &Stub{
+		Service:      "Chat",
+		Method:       "Talk",
+		Conversation: conversation,
+		Output:       Output{Stream: []map[string]interface{}{{"text": "welcome"}}},
+	}
+	require.NoError(t, validateStub(stub))
+	require.NoError(t, storeStub(stub))
+
+	got, err = findStub(&findStubPayload{Service: "Chat", Method: "Talk", Event: EventOpen, Headers: map[string]string{"user": "ann"}})
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{{"text": "welcome"}}, got.Stream)
+	require.NotNil(t, got.conversation)
+	assert.Equal(t, "ping ann", got.conversation.Timers[0].Data["text"])
+	assert.Equal(t, 2, got.conversation.CloseAfter)
+	assert.Equal(t, "ping {{ .Headers.user }}", conversation.Timers[0].Data["text"])
+
+	// messages are still answered by the other stubs
+	got, err = findStub(&findStubPayload{Service: "Chat", Method: "Talk", Data: map[string]interface{}{"text": "hi"}})
+	require.NoError(t, err)
+	assert.Equal(t, "hello", got.Data["text"])
+	assert.Nil(t, got.conversation)
+}
+
+func TestConversationValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		conversation Conversation
+		wantErr      string
+	}{
+		{name: "valid", conversation: Conversation{Timers: []Timer{{After: Duration(time.Second), Data: map[string]interface{}{}}}, CloseAfter: 1}},
+		{name: "negative interval", conversation: Conversation{Timers: []Timer{{Every: Duration(-time.Second), Data: map[string]interface{}{}}}}, wantErr: "timers[0]"},
+		{name: "timer without data", conversation: Conversation{Timers: []Timer{{After: Duration(time.Second)}}}, wantErr: "data can't be empty"},
+		{name: "negative close_after", conversation: Conversation{CloseAfter: -1}, wantErr: "close_after"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.conversation.validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
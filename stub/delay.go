@@ -0,0 +1,123 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	DelayFixed     = "fixed"
+	DelayUniform   = "uniform"
+	DelayNormal    = "normal"
+	DelayLogNormal = "lognormal"
+)
+
+// z-score of the 99th percentile of the standard normal distribution
+const z99 = 2.3263478740408408
+
+// Delay is how long the server waits before responding. It is either
+// fixed, uniform between Min and Max, or normal/log-normal described by
+// its 50th and 99th percentiles. Max, when set, caps sampled delays.
+// Hang waits until the client's deadline instead.
+type Delay struct {
+	Hang         bool     `json:"hang,omitempty"`
+	Distribution string   `json:"distribution,omitempty"`
+	Fixed        Duration `json:"fixed,omitempty"`
+	Min          Duration `json:"min,omitempty"`
+	Max          Duration `json:"max,omitempty"`
+	P50          Duration `json:"p50,omitempty"`
+	P99          Duration `json:"p99,omitempty"`
+}
+
+// UnmarshalJSON also accepts a plain duration as a fixed delay
+func (d *Delay) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] != '{' {
+		var fixed Duration
+		if err := fixed.UnmarshalJSON(b); err != nil {
+			return err
+		}
+		*d = Delay{Fixed: fixed}
+		return nil
+	}
+
+	type delay Delay
+	return json.Unmarshal(b, (*delay)(d))
+}
+
+func (d *Delay) distribution() string {
+	if d.Distribution != "" {
+		return d.Distribution
+	}
+	if d.Max > 0 {
+		return DelayUniform
+	}
+	return DelayFixed
+}
+
+func (d *Delay) validate() error {
+	for _, v := range []Duration{d.Fixed, d.Min, d.Max, d.P50, d.P99} {
+		if v < 0 {
+			return fmt.Errorf("delay can't be negative")
+		}
+	}
+
+	switch d.distribution() {
+	case DelayFixed:
+	case DelayUniform:
+		if d.Max < d.Min {
+			return fmt.Errorf("delay max can't be less than min")
+		}
+	case DelayNormal, DelayLogNormal:
+		if d.P50 <= 0 || d.P99 <= d.P50 {
+			return fmt.Errorf("%s delay needs p50 > 0 and p99 > p50", d.Distribution)
+		}
+	default:
+		return fmt.Errorf("delay distribution must be one of %s, %s, %s or %s", DelayFixed, DelayUniform, DelayNormal, DelayLogNormal)
+	}
+	return nil
+}
+
+// sampleEach resolves n delays, such as the delays between stream messages. caller must hold mx.
+func (d *Delay) sampleEach(n int) []*Delay {
+	if d == nil || n <= 0 {
+		return nil
+	}
+	delays := make([]*Delay, n)
+	for i := range delays {
+		delays[i] = d.sample()
+	}
+	return delays
+}
+
+// sample resolves the delay of a single response. caller must hold mx.
+func (d *Delay) sample() *Delay {
+	if d == nil {
+		return nil
+	}
+	if d.Hang {
+		return &Delay{Hang: true}
+	}
+
+	var v float64
+	switch d.distribution() {
+	case DelayFixed:
+		return &Delay{Fixed: d.Fixed}
+	case DelayUniform:
+		v = float64(d.Min) + rnd.Float64()*float64(d.Max-d.Min)
+	case DelayNormal:
+		sigma := float64(d.P99-d.P50) / z99
+		v = float64(d.P50) + rnd.NormFloat64()*sigma
+	case DelayLogNormal:
+		mu := math.Log(float64(d.P50))
+		sigma := (math.Log(float64(d.P99)) - mu) / z99
+		v = math.Exp(mu + rnd.NormFloat64()*sigma)
+	}
+
+	v = math.Max(v, 0)
+	if d.Max > 0 {
+		v = math.Min(v, float64(d.Max))
+	}
+	return &Delay{Fixed: Duration(time.Duration(v))}
+}
@@ -0,0 +1,112 @@
+package stub
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelayJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want Delay
+	}{
+		{name: "duration string", json: `"150ms"`, want: Delay{Fixed: Duration(150 * time.Millisecond)}},
+		{name: "milliseconds", json: `200`, want: Delay{Fixed: Duration(200 * time.Millisecond)}},
+		{name: "uniform", json: `{"min":"10ms","max":"20ms"}`, want: Delay{Min: Duration(10 * time.Millisecond), Max: Duration(20 * time.Millisecond)}},
+		{
+			name: "lognormal",
+			json: `{"distribution":"lognormal","p50":"50ms","p99":"1s"}`,
+			want: Delay{Distribution: DelayLogNormal, P50: Duration(50 * time.Millisecond), P99: Duration(time.Second)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Delay
+			require.NoError(t, json.Unmarshal([]byte(tt.json), &got))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	var invalid Delay
+	assert.Error(t, json.Unmarshal([]byte(`"soon"`), &invalid))
+}
+
+func TestDelayValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		delay   Delay
+		wantErr string
+	}{
+		{name: "fixed", delay: Delay{Fixed: Duration(time.Second)}},
+		{name: "negative", delay: Delay{Fixed: Duration(-time.Second)}, wantErr: "can't be negative"},
+		{name: "max before min", delay: Delay{Min: Duration(2 * time.Second), Max: Duration(time.Second)}, wantErr: "less than min"},
+		{name: "missing percentiles", delay: Delay{Distribution: DelayNormal, P50: Duration(time.Second)}, wantErr: "p99 > p50"},
+		{name: "unknown distribution", delay: Delay{Distribution: "pareto"}, wantErr: "must be one of"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.delay.validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestDelaySample(t *testing.T) {
+	var nilDelay *Delay
+	assert.Nil(t, nilDelay.sample())
+
+	fixed := &Delay{Fixed: Duration(time.Second)}
+	assert.Equal(t, &Delay{Fixed: Duration(time.Second)}, fixed.sample())
+
+	tests := []struct {
+		name     string
+		delay    Delay
+		min, max time.Duration
+	}{
+		{name: "uniform", delay: Delay{Min: Duration(10 * time.Millisecond), Max: Duration(20 * time.Millisecond)}, min: 10 * time.Millisecond, max: 20 * time.Millisecond},
+		{name: "normal capped", delay: Delay{Distribution: DelayNormal, P50: Duration(100 * time.Millisecond), P99: Duration(time.Second), Max: Duration(300 * time.Millisecond)}, min: 0, max: 300 * time.Millisecond},
+		{name: "lognormal", delay: Delay{Distribution: DelayLogNormal, P50: Duration(50 * time.Millisecond), P99: Duration(time.Second)}, min: 1, max: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				got := time.Duration(tt.delay.sample().Fixed)
+				assert.GreaterOrEqual(t, got, tt.min)
+				assert.LessOrEqual(t, got, tt.max)
+			}
+		})
+	}
+}
+
+func Test_findStubDelay(t *testing.T) {
+	clearStorage()
+	require.NoError(t, storeStub(&Stub{
+		Service: "Payments",
+		Method:  "Charge",
+		Input:   Input{Contains: map[string]interface{}{"id": "1"}},
+		Output: Output{
+			Data:  map[string]interface{}{"status": "OK"},
+			Delay: &Delay{Min: Duration(10 * time.Millisecond), Max: Duration(20 * time.Millisecond)},
+		},
+	}))
+
+	got, err := findStub(&findStubPayload{Service: "Payments", Method: "Charge", Data: map[string]interface{}{"id": "1"}})
+	require.NoError(t, err)
+	require.NotNil(t, got.Delay)
+	assert.Empty(t, got.Delay.Distribution)
+	assert.Zero(t, got.Delay.Max)
+	assert.GreaterOrEqual(t, time.Duration(got.Delay.Fixed), 10*time.Millisecond)
+}
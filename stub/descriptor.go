@@ -0,0 +1,308 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// descriptors are the proto files of the mocked services, which the stubs are
+// validated against. nil skips the validation. set once at startup.
+var descriptors *protoregistry.Files
+
+// loadDescriptors reads the FileDescriptorSet written by protoc with --descriptor_set_out
+// and --include_imports
+func loadDescriptors(path string) error {
+	byt, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(byt, set); err != nil {
+		return fmt.Errorf("invalid descriptor set %s: %v", path, err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return fmt.Errorf("invalid descriptor set %s: %v", path, err)
+	}
+	descriptors = files
+	return nil
+}
+
+// validateStubDescriptor checks the stub against the proto of its method: the input
+// rules must refer to fields of the request, and the output data must be a valid
+// response. template strings are left out, they're only known at call time.
+func validateStubDescriptor(stub *Stub) error {
+	if descriptors == nil {
+		return nil
+	}
+
+	method, err := findMethodDescriptor(stub.Service, stub.Method)
+	if err != nil {
+		return err
+	}
+
+	if err := validateInputFields(stub.Input, method.Input()); err != nil {
+		return fmt.Errorf("input: %v", err)
+	}
+
+	if len(stub.Outputs) > 0 {
+		for i, output := range stub.Outputs {
+			if err := validateOutputData(output, method.Output()); err != nil {
+				return fmt.Errorf("Outputs[%d]: %v", i, err)
+			}
+		}
+	} else if err := validateOutputData(stub.Output, method.Output()); err != nil {
+		return fmt.Errorf("output: %v", err)
+	}
+
+	if stub.Conversation != nil {
+		for i, timer := range stub.Conversation.Timers {
+			if err := validateMessage(timer.Data, method.Output()); err != nil {
+				return fmt.Errorf("conversation: timers[%d]: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// findMethodDescriptor finds a method of a service given by its name or full name.
+// the method is named as the generated server names it, with its first letter upper cased.
+func findMethodDescriptor(service, method string) (protoreflect.MethodDescriptor, error) {
+	var (
+		found  protoreflect.MethodDescriptor
+		exists bool
+	)
+	descriptors.RangeFiles(func(file protoreflect.FileDescriptor) bool {
+		services := file.Services()
+		for i := 0; i < services.Len(); i++ {
+			svc := services.Get(i)
+			if string(svc.Name()) != service && string(svc.FullName()) != service {
+				continue
+			}
+			exists = true
+			methods := svc.Methods()
+			for j := 0; j < methods.Len(); j++ {
+				if strings.Title(string(methods.Get(j).Name())) == method {
+					found = methods.Get(j)
+					return false
+				}
+			}
+		}
+		return true
+	})
+
+	switch {
+	case found != nil:
+		return found, nil
+	case exists:
+		return nil, fmt.Errorf("method %s not found in service %s", method, service)
+	default:
+		return nil, fmt.Errorf("service %s not found in the proto files", service)
+	}
+}
+
+// validateInputFields checks that the rules of an input only refer to fields of the request.
+// paths and expr rules aren't checked.
+func validateInputFields(input Input, message protoreflect.MessageDescriptor) error {
+	rules := map[string]map[string]interface{}{
+		"equals":           input.Equals,
+		"equals_unordered": input.EqualsUnordered,
+		"contains":         input.Contains,
+		"matches":          input.Matches,
+		"compare":          input.Compare,
+	}
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := validateFields(rules[name], message, name); err != nil {
+			return err
+		}
+	}
+
+	if input.Stream != nil {
+		for i, expect := range input.Stream.Equals {
+			if err := validateFields(expect, message, fmt.Sprintf("stream.equals[%d]", i)); err != nil {
+				return err
+			}
+		}
+		for i, expect := range input.Stream.Contains {
+			if err := validateFields(expect, message, fmt.Sprintf("stream.contains[%d]", i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, nested := range input.AllOf {
+		if err := validateInputFields(nested, message); err != nil {
+			return fmt.Errorf("all_of[%d].%v", i, err)
+		}
+	}
+	for i, nested := range input.AnyOf {
+		if err := validateInputFields(nested, message); err != nil {
+			return fmt.Errorf("any_of[%d].%v", i, err)
+		}
+	}
+	if input.Not != nil {
+		if err := validateInputFields(*input.Not, message); err != nil {
+			return fmt.Errorf("not.%v", err)
+		}
+	}
+	return nil
+}
+
+// validateFields checks that the keys of a rule are fields of the message, down to nested messages
+func validateFields(rule map[string]interface{}, message protoreflect.MessageDescriptor, path string) error {
+	for key, value := range rule {
+		field := message.Fields().ByName(protoreflect.Name(key))
+		if field == nil {
+			field = message.Fields().ByJSONName(key)
+		}
+		if field == nil {
+			// the request is sent as its go struct, which holds a oneof in a field named after it
+			if isOneofField(message, key) {
+				continue
+			}
+			return fmt.Errorf("%s: field %s not found in %s", path, key, message.FullName())
+		}
+
+		fieldPath := path + "." + key
+		switch {
+		case field.IsMap():
+			values, ok := value.(map[string]interface{})
+			if !ok || field.MapValue().Message() == nil {
+				continue
+			}
+			for mapKey, mapValue := range values {
+				if nested, ok := mapValue.(map[string]interface{}); ok {
+					if err := validateFields(nested, field.MapValue().Message(), fieldPath+"."+mapKey); err != nil {
+						return err
+					}
+				}
+			}
+		case field.Message() != nil:
+			items := []interface{}{value}
+			if list, ok := value.([]interface{}); ok && field.IsList() {
+				items = list
+			}
+			for _, item := range items {
+				if nested, ok := item.(map[string]interface{}); ok {
+					if err := validateFields(nested, field.Message(), fieldPath); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isOneofField tells whether a key is the go field holding a oneof of the message
+func isOneofField(message protoreflect.MessageDescriptor, key string) bool {
+	oneofs := message.Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		if goCamelCase(string(oneofs.Get(i).Name())) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// goCamelCase is the go name of a proto name, e.g. reply_type is ReplyType
+func goCamelCase(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		switch {
+		case r == '_':
+			upper = true
+		case upper && r >= 'a' && r <= 'z':
+			b.WriteRune(r - 'a' + 'A')
+			upper = false
+		default:
+			b.WriteRune(r)
+			upper = false
+		}
+	}
+	return b.String()
+}
+
+// validateOutputData checks the messages of an output against the response message
+func validateOutputData(output Output, message protoreflect.MessageDescriptor) error {
+	if output.Data != nil {
+		if err := validateMessage(output.Data, message); err != nil {
+			return fmt.Errorf("data: %v", err)
+		}
+	}
+	for i, data := range output.Stream {
+		if err := validateMessage(data, message); err != nil {
+			return fmt.Errorf("stream[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// protojsonErrorPrefix is the start of protojson errors, before the wrong field. the position
+// refers to the json made from the stub, not to the stub file. protobuf randomly puts a
+// non-breaking space after "proto:" to keep errors from being parsed.
+var protojsonErrorPrefix = regexp.MustCompile(`^proto:[\s\x{00a0}]*(\(line \d+:\d+\): )?`)
+
+// validateMessage checks that data decodes to the message, as the generated server decodes it
+func validateMessage(data map[string]interface{}, message protoreflect.MessageDescriptor) error {
+	byt, err := json.Marshal(withoutTemplates(data))
+	if err != nil {
+		return err
+	}
+
+	options := protojson.UnmarshalOptions{Resolver: dynamicpb.NewTypes(descriptors)}
+	if err := options.Unmarshal(byt, dynamicpb.NewMessage(message)); err != nil {
+		return fmt.Errorf("%s", protojsonErrorPrefix.ReplaceAllString(err.Error(), ""))
+	}
+	return nil
+}
+
+// withoutTemplates returns a copy of the value without the strings holding templates
+func withoutTemplates(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			if isTemplateValue(val) {
+				continue
+			}
+			copied[key] = withoutTemplates(val)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, 0, len(v))
+		for _, val := range v {
+			if isTemplateValue(val) {
+				continue
+			}
+			copied = append(copied, withoutTemplates(val))
+		}
+		return copied
+	}
+	return value
+}
+
+func isTemplateValue(value interface{}) bool {
+	s, ok := value.(string)
+	return ok && isTemplate(s)
+}
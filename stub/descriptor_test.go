@@ -0,0 +1,211 @@
+package stub
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const usersProto = `
+name: "users.proto"
+package: "users"
+dependency: "google/protobuf/timestamp.proto"
+syntax: "proto3"
+message_type {
+  name: "GetUserRequest"
+  field { name: "id" number: 1 type: TYPE_INT32 json_name: "id" }
+  field { name: "full_name" number: 2 type: TYPE_STRING json_name: "fullName" }
+  field { name: "filter" number: 3 type: TYPE_MESSAGE type_name: ".users.Filter" json_name: "filter" }
+  field { name: "filters" number: 4 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".users.Filter" json_name: "filters" }
+  field { name: "email" number: 5 type: TYPE_STRING oneof_index: 0 json_name: "email" }
+  oneof_decl { name: "lookup_key" }
+}
+message_type {
+  name: "Filter"
+  field { name: "key" number: 1 type: TYPE_STRING json_name: "key" }
+}
+message_type {
+  name: "User"
+  field { name: "id" number: 1 type: TYPE_INT32 json_name: "id" }
+  field { name: "full_name" number: 2 type: TYPE_STRING json_name: "fullName" }
+  field { name: "status" number: 3 type: TYPE_ENUM type_name: ".users.Status" json_name: "status" }
+  field { name: "created_at" number: 4 type: TYPE_MESSAGE type_name: ".google.protobuf.Timestamp" json_name: "createdAt" }
+  field { name: "email" number: 5 type: TYPE_STRING oneof_index: 0 json_name: "email" }
+  field { name: "phone" number: 6 type: TYPE_STRING oneof_index: 0 json_name: "phone" }
+  oneof_decl { name: "contact" }
+}
+enum_type {
+  name: "Status"
+  value { name: "UNKNOWN" number: 0 }
+  value { name: "ACTIVE" number: 1 }
+}
+service {
+  name: "Users"
+  method { name: "GetUser" input_type: ".users.GetUserRequest" output_type: ".users.User" }
+  method { name: "listUsers" input_type: ".users.GetUserRequest" output_type: ".users.User" server_streaming: true }
+}
+`
+
+// useUsersDescriptors validates the stubs of the test against usersProto
+func useUsersDescriptors(t *testing.T) {
+	file := &descriptorpb.FileDescriptorProto{}
+	require.NoError(t, prototext.Unmarshal([]byte(usersProto), file))
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		protodesc.ToFileDescriptorProto(timestamppb.File_google_protobuf_timestamp_proto),
+		file,
+	}}
+	byt, err := proto.Marshal(set)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "descriptor.pb")
+	require.NoError(t, os.WriteFile(path, byt, 0o644))
+	require.NoError(t, loadDescriptors(path))
+	t.Cleanup(func() { descriptors = nil })
+}
+
+func Test_validateStubDescriptor(t *testing.T) {
+	useUsersDescriptors(t)
+
+	user := func(data map[string]interface{}) Output {
+		return Output{Data: data}
+	}
+	tests := []struct {
+		name    string
+		stub    Stub
+		wantErr string
+	}{
+		{
+			name: "valid",
+			stub: Stub{
+				Service: "Users",
+				Method:  "getUser",
+				Input: Input{
+					Equals:   map[string]interface{}{"id": float64(1), "full_name": "ann", "LookupKey": map[string]interface{}{}},
+					Contains: map[string]interface{}{"filter": map[string]interface{}{"key": "a"}, "filters": []interface{}{map[string]interface{}{"key": "b"}}},
+					Paths:    map[string]interface{}{"$.whatever": "x"},
+				},
+				Output: user(map[string]interface{}{
+					"id":         "{{ .Request.id }}",
+					"fullName":   "Ann",
+					"status":     "ACTIVE",
+					"created_at": "2024-01-01T00:00:00Z",
+					"email":      "ann@example.com",
+				}),
+			},
+		},
+		{
+			name: "full service name",
+			stub: Stub{Service: "users.Users", Method: "GetUser", Input: Input{Equals: map[string]interface{}{"id": float64(1)}}, Output: user(map[string]interface{}{})},
+		},
+		{
+			name: "lower camel method",
+			stub: Stub{Service: "Users", Method: "listUsers", Input: Input{Equals: map[string]interface{}{"id": float64(1)}}, Output: Output{Stream: []map[string]interface{}{{"id": float64(1)}}}},
+		},
+		{
+			name:    "unknown service",
+			stub:    Stub{Service: "Accounts", Method: "GetUser", Input: Input{Equals: map[string]interface{}{"id": float64(1)}}, Output: user(map[string]interface{}{})},
+			wantErr: "service Accounts not found in the proto files",
+		},
+		{
+			name:    "unknown method",
+			stub:    Stub{Service: "Users", Method: "DeleteUser", Input: Input{Equals: map[string]interface{}{"id": float64(1)}}, Output: user(map[string]interface{}{})},
+			wantErr: "method DeleteUser not found in service Users",
+		},
+		{
+			name:    "unknown input field",
+			stub:    Stub{Service: "Users", Method: "GetUser", Input: Input{Equals: map[string]interface{}{"idd": float64(1)}}, Output: user(map[string]interface{}{})},
+			wantErr: "input: equals: field idd not found in users.GetUserRequest",
+		},
+		{
+			name:    "unknown nested input field",
+			stub:    Stub{Service: "Users", Method: "GetUser", Input: Input{Contains: map[string]interface{}{"filters": []interface{}{map[string]interface{}{"kee": "a"}}}}, Output: user(map[string]interface{}{})},
+			wantErr: "input: contains.filters: field kee not found in users.Filter",
+		},
+		{
+			name: "unknown input field in combinator",
+			stub: Stub{Service: "Users", Method: "GetUser", Input: Input{
+				AnyOf: []Input{{Equals: map[string]interface{}{"id": float64(1)}}, {Matches: map[string]interface{}{"name": "a.*"}}},
+			}, Output: user(map[string]interface{}{})},
+			wantErr: "input: any_of[1].matches: field name not found",
+		},
+		{
+			name:    "unknown output field",
+			stub:    Stub{Service: "Users", Method: "GetUser", Input: Input{Equals: map[string]interface{}{"id": float64(1)}}, Output: user(map[string]interface{}{"nmae": "ann"})},
+			wantErr: `output: data: unknown field "nmae"`,
+		},
+		{
+			name:    "wrong output type",
+			stub:    Stub{Service: "Users", Method: "GetUser", Input: Input{Equals: map[string]interface{}{"id": float64(1)}}, Output: user(map[string]interface{}{"id": "one"})},
+			wantErr: "output: data: invalid value for int32 field id",
+		},
+		{
+			name:    "unknown enum name",
+			stub:    Stub{Service: "Users", Method: "GetUser", Input: Input{Equals: map[string]interface{}{"id": float64(1)}}, Output: user(map[string]interface{}{"status": "DELETED"})},
+			wantErr: "invalid value for enum field status",
+		},
+		{
+			name:    "two fields of a oneof",
+			stub:    Stub{Service: "Users", Method: "GetUser", Input: Input{Equals: map[string]interface{}{"id": float64(1)}}, Output: user(map[string]interface{}{"email": "a@b.c", "phone": "123"})},
+			wantErr: "oneof",
+		},
+		{
+			name: "invalid message of a sequence",
+			stub: Stub{Service: "Users", Method: "GetUser", Input: Input{Equals: map[string]interface{}{"id": float64(1)}}, Outputs: []Output{
+				user(map[string]interface{}{"id": float64(1)}),
+				{Stream: []map[string]interface{}{{"id": float64(2)}, {"idd": float64(3)}}},
+			}},
+			wantErr: "Outputs[1]: stream[1]: ",
+		},
+		{
+			name: "invalid conversation timer",
+			stub: Stub{Service: "Users", Method: "GetUser", Conversation: &Conversation{
+				Timers: []Timer{{Every: Duration(1), Data: map[string]interface{}{"fullname": "x"}}},
+			}},
+			wantErr: "conversation: timers[0]: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateStub(&tt.stub)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func Test_validateStubDescriptorDisabled(t *testing.T) {
+	// without descriptors, stubs of any service are accepted
+	stub := &Stub{Service: "Accounts", Method: "Anything", Input: Input{Equals: map[string]interface{}{"x": float64(1)}}, Output: Output{Data: map[string]interface{}{"y": "z"}}}
+	assert.NoError(t, validateStub(stub))
+}
+
+func Test_withoutTemplates(t *testing.T) {
+	data := map[string]interface{}{
+		"id":   "{{ .Request.id }}",
+		"name": "ann",
+		"tags": []interface{}{"{{ uuid }}", "b"},
+		"nested": map[string]interface{}{
+			"at": "{{ now }}",
+			"n":  float64(1),
+		},
+	}
+	assert.Equal(t, map[string]interface{}{
+		"name":   "ann",
+		"tags":   []interface{}{"b"},
+		"nested": map[string]interface{}{"n": float64(1)},
+	}, withoutTemplates(data))
+	assert.Equal(t, "{{ .Request.id }}", data["id"])
+}
@@ -0,0 +1,98 @@
+package stub
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+)
+
+// exprEnv declares what an expr rule can refer to:
+// the request message as request, and the request headers as headers
+var exprEnv, _ = cel.NewEnv(
+	cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+	cel.Variable("headers", cel.MapType(cel.StringType, cel.StringType)),
+	cel.CrossTypeNumericComparisons(true),
+)
+
+// exprPrograms caches compiled expressions, keyed by their source,
+// so that they're compiled when stubs are stored rather than on every match
+var exprPrograms = map[string]cel.Program{}
+var exprMx = sync.Mutex{}
+
+func compileExpr(expr string) (cel.Program, error) {
+	exprMx.Lock()
+	defer exprMx.Unlock()
+
+	if prg, ok := exprPrograms[expr]; ok {
+		return prg, nil
+	}
+
+	ast, iss := exprEnv.Compile(expr)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("expr must evaluate to bool, got %s", ast.OutputType())
+	}
+
+	prg, err := exprEnv.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	exprPrograms[expr] = prg
+	return prg, nil
+}
+
+// compileExprs compiles the expr rules of the input and its nested blocks
+func compileExprs(input Input) error {
+	if input.Expr != "" {
+		if _, err := compileExpr(input.Expr); err != nil {
+			return fmt.Errorf("invalid expr rule: %v", err)
+		}
+	}
+	for _, sub := range input.AllOf {
+		if err := compileExprs(sub); err != nil {
+			return err
+		}
+	}
+	for _, sub := range input.AnyOf {
+		if err := compileExprs(sub); err != nil {
+			return err
+		}
+	}
+	if input.Not != nil {
+		return compileExprs(*input.Not)
+	}
+	return nil
+}
+
+// evalExpr tells whether the request satisfies the expression.
+// evaluation errors, such as a missing field, count as no match.
+func evalExpr(expr string, stub *findStubPayload) bool {
+	prg, err := compileExpr(expr)
+	if err != nil {
+		log.Printf("Error on compiling expr %s error:%v\n", expr, err)
+		return false
+	}
+
+	request := stub.Data
+	if request == nil {
+		request = map[string]interface{}{}
+	}
+	headers := stub.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+
+	out, _, err := prg.Eval(map[string]interface{}{
+		"request": request,
+		"headers": headers,
+	})
+	if err != nil {
+		return false
+	}
+	result, ok := out.Value().(bool)
+	return ok && result
+}
@@ -0,0 +1,104 @@
+package stub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_evalExpr(t *testing.T) {
+	tests := []struct {
+		name    string
+		expr    string
+		data    map[string]interface{}
+		headers map[string]string
+		want    bool
+	}{
+		{
+			name:    "request and headers",
+			expr:    `request.amount > 100 && headers["x-tenant"] == "acme"`,
+			data:    map[string]interface{}{"amount": float64(150)},
+			headers: map[string]string{"x-tenant": "acme"},
+			want:    true,
+		},
+		{
+			name:    "headers mismatch",
+			expr:    `request.amount > 100 && headers["x-tenant"] == "acme"`,
+			data:    map[string]interface{}{"amount": float64(150)},
+			headers: map[string]string{"x-tenant": "other"},
+			want:    false,
+		},
+		{
+			name: "nested fields and macros",
+			expr: `request.items.exists(i, i.sku == "X") && size(request.items) == 2`,
+			data: map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"sku": "Y"},
+				map[string]interface{}{"sku": "X"},
+			}},
+			want: true,
+		},
+		{
+			name: "string encoded int64",
+			expr: `int(request.id) > 9007199254740992`,
+			data: map[string]interface{}{"id": "9007199254740993"},
+			want: true,
+		},
+		{
+			name: "missing field is no match",
+			expr: `request.amount > 100`,
+			data: map[string]interface{}{},
+			want: false,
+		},
+		{
+			name: "missing header is no match",
+			expr: `headers["x-tenant"] == "acme"`,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := evalExpr(tt.expr, &findStubPayload{Data: tt.data, Headers: tt.headers})
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_compileExprs(t *testing.T) {
+	require.NoError(t, compileExprs(Input{Expr: `request.a == 1`}))
+
+	err := compileExprs(Input{AnyOf: []Input{{Expr: `request.a ==`}}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid expr rule")
+
+	err = compileExprs(Input{Expr: `request.a`})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "must evaluate to bool")
+}
+
+func Test_findStubExpr(t *testing.T) {
+	clearStorage()
+	err := storeStub(&Stub{
+		Service: "Payments",
+		Method:  "Charge",
+		Input:   Input{Expr: `request.amount >`},
+		Output:  Output{Data: map[string]interface{}{"status": "OK"}},
+	})
+	require.Error(t, err)
+
+	require.NoError(t, storeStub(&Stub{
+		Service: "Payments",
+		Method:  "Charge",
+		Input:   Input{Expr: `request.amount > 100 && headers["x-tenant"] == "acme"`},
+		Output:  Output{Data: map[string]interface{}{"status": "OK"}},
+	}))
+	got, err := findStub(&findStubPayload{
+		Service: "Payments",
+		Method:  "Charge",
+		Data:    map[string]interface{}{"amount": float64(101)},
+		Headers: map[string]string{"x-tenant": "acme"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "OK", got.Data["status"])
+}
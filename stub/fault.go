@@ -0,0 +1,134 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+)
+
+// Fault makes a share of the calls fail. Rate is the probability, between 0 and 1,
+// that a call responds with Code and Error, or hangs until the client's deadline.
+type Fault struct {
+	Rate  float64     `json:"rate"`
+	Code  *codes.Code `json:"code,omitempty"`
+	Error string      `json:"error,omitempty"`
+	Hang  bool        `json:"hang,omitempty"`
+}
+
+// chaos is the server-wide fault configuration applied to every call
+type chaos struct {
+	Seed   *int64  `json:"seed,omitempty"`
+	Faults []Fault `json:"faults"`
+}
+
+// guarded by mx
+var chaosConfig = chaos{}
+
+func validateFaults(faults []Fault) error {
+	total := 0.0
+	for i, fault := range faults {
+		if fault.Rate <= 0 || fault.Rate > 1 {
+			return fmt.Errorf("faults[%d]: rate must be greater than 0 and at most 1", i)
+		}
+		if fault.Code != nil && *fault.Code == codes.OK {
+			return fmt.Errorf("faults[%d]: code can't be OK", i)
+		}
+		total += fault.Rate
+	}
+	if total > 1 {
+		return fmt.Errorf("the rates of faults add up to more than 1")
+	}
+	return nil
+}
+
+// injectFault rolls the faults against each other and returns
+// the output of the one that fires, if any. caller must hold mx.
+func injectFault(faults []Fault) (*Output, bool) {
+	if len(faults) == 0 {
+		return nil, false
+	}
+
+	roll := rnd.Float64()
+	for _, fault := range faults {
+		if roll < fault.Rate {
+			return fault.output(), true
+		}
+		roll -= fault.Rate
+	}
+	return nil, false
+}
+
+func (f Fault) output() *Output {
+	if f.Hang {
+		return &Output{Delay: &Delay{Hang: true}, fault: true}
+	}
+
+	code := codes.Unavailable
+	if f.Code != nil {
+		code = *f.Code
+	}
+	msg := f.Error
+	if msg == "" {
+		msg = "injected fault: " + code.String()
+	}
+	return &Output{Error: msg, Code: &code, fault: true}
+}
+
+// seedRandom makes faults, delays and random template values reproducible
+func seedRandom(seed int64) {
+	mx.Lock()
+	defer mx.Unlock()
+	rnd.Seed(seed)
+}
+
+func setChaos(config chaos) {
+	mx.Lock()
+	defer mx.Unlock()
+	if config.Seed != nil {
+		rnd.Seed(*config.Seed)
+	}
+	chaosConfig = config
+}
+
+func getChaos() chaos {
+	mx.Lock()
+	defer mx.Unlock()
+	return chaosConfig
+}
+
+func handleGetChaos(w http.ResponseWriter, r *http.Request) {
+	config := getChaos()
+	if config.Faults == nil {
+		config.Faults = []Fault{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(config); err != nil {
+		log.Println("Error writing handleGetChaos response: %w", err)
+	}
+}
+
+func handleSetChaos(w http.ResponseWriter, r *http.Request) {
+	config := chaos{}
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		responseError(err, w)
+		return
+	}
+	if err := validateFaults(config.Faults); err != nil {
+		responseError(err, w)
+		return
+	}
+
+	setChaos(config)
+	handleGetChaos(w, r)
+}
+
+func handleClearChaos(w http.ResponseWriter, r *http.Request) {
+	setChaos(chaos{})
+	if _, err := w.Write([]byte("OK")); err != nil {
+		log.Println("Error writing handleClearChaos response: %w", err)
+	}
+}
@@ -0,0 +1,138 @@
+package stub
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func Test_validateFaults(t *testing.T) {
+	ok := codes.OK
+	tests := []struct {
+		name    string
+		faults  []Fault
+		wantErr string
+	}{
+		{name: "valid", faults: []Fault{{Rate: 0.05}, {Rate: 0.01, Hang: true}}},
+		{name: "zero rate", faults: []Fault{{Rate: 0}}, wantErr: "faults[0]: rate"},
+		{name: "rate above 1", faults: []Fault{{Rate: 1.5}}, wantErr: "faults[0]: rate"},
+		{name: "code OK", faults: []Fault{{Rate: 0.1, Code: &ok}}, wantErr: "can't be OK"},
+		{name: "rates above 1", faults: []Fault{{Rate: 0.6}, {Rate: 0.6}}, wantErr: "add up"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateFaults(tt.faults)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func Test_injectFaultSeed(t *testing.T) {
+	faults := []Fault{{Rate: 0.3}, {Rate: 0.2, Hang: true}}
+	roll := func() []string {
+		results := []string{}
+		for i := 0; i < 50; i++ {
+			output, ok := injectFault(faults)
+			switch {
+			case !ok:
+				results = append(results, "ok")
+			case output.Delay != nil:
+				results = append(results, "hang")
+			default:
+				results = append(results, output.Code.String())
+			}
+		}
+		return results
+	}
+
+	seedRandom(42)
+	first := roll()
+	seedRandom(42)
+	assert.Equal(t, first, roll())
+	assert.Contains(t, first, "ok")
+	assert.Contains(t, first, "hang")
+	assert.Contains(t, first, "Unavailable")
+}
+
+func Test_findStubFaults(t *testing.T) {
+	clearStorage()
+	unavailable := codes.Unavailable
+	require.NoError(t, storeStub(&Stub{
+		Service: "Payments",
+		Method:  "Charge",
+		Times:   1,
+		Input:   Input{Contains: map[string]interface{}{"id": "1"}},
+		Output:  Output{Data: map[string]interface{}{"status": "OK"}},
+		Faults:  []Fault{{Rate: 1, Code: &unavailable, Error: "try again"}},
+	}))
+	payload := &findStubPayload{Service: "Payments", Method: "Charge", Data: map[string]interface{}{"id": "1"}}
+
+	// faulted calls don't count against times
+	for i := 0; i < 3; i++ {
+		got, err := findStub(payload)
+		require.NoError(t, err)
+		assert.Equal(t, "try again", got.Error)
+		assert.Equal(t, codes.Unavailable, *got.Code)
+	}
+
+	requests := allRequests(requestFilter{Outcome: OutcomeFault})
+	require.Len(t, requests, 3)
+	assert.NotEmpty(t, requests[0].StubID)
+	assert.Equal(t, codes.Unavailable, requests[0].Code)
+}
+
+func TestChaos(t *testing.T) {
+	clearStorage()
+	defer setChaos(chaos{})
+	require.NoError(t, storeStub(&Stub{
+		Service: "Payments",
+		Method:  "Charge",
+		Input:   Input{Contains: map[string]interface{}{"id": "1"}},
+		Output:  Output{Data: map[string]interface{}{"status": "OK"}},
+	}))
+	payload := &findStubPayload{Service: "Payments", Method: "Charge", Data: map[string]interface{}{"id": "1"}}
+
+	body := []byte(`{"seed":7,"faults":[{"rate":1,"hang":true}]}`)
+	res := httptest.NewRecorder()
+	handleSetChaos(res, httptest.NewRequest(http.MethodPut, "/chaos", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, res.Code)
+
+	got, err := findStub(payload)
+	require.NoError(t, err)
+	assert.Equal(t, &Delay{Hang: true}, got.Delay)
+
+	requests := allRequests(requestFilter{Outcome: OutcomeFault})
+	require.Len(t, requests, 1)
+	assert.Empty(t, requests[0].StubID)
+	assert.Equal(t, codes.DeadlineExceeded, requests[0].Code)
+
+	res = httptest.NewRecorder()
+	handleSetChaos(res, httptest.NewRequest(http.MethodPut, "/chaos", bytes.NewReader([]byte(`{"faults":[{"rate":2}]}`))))
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+
+	res = httptest.NewRecorder()
+	handleClearChaos(res, httptest.NewRequest(http.MethodDelete, "/chaos", nil))
+	require.Equal(t, http.StatusOK, res.Code)
+
+	got, err = findStub(payload)
+	require.NoError(t, err)
+	assert.Equal(t, "OK", got.Data["status"])
+
+	res = httptest.NewRecorder()
+	handleGetChaos(res, httptest.NewRequest(http.MethodGet, "/chaos", nil))
+	config := chaos{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&config))
+	assert.Empty(t, config.Faults)
+}
@@ -0,0 +1,274 @@
+package stub
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// outcomes of a recorded request
+const (
+	OutcomeMatched  = "matched"
+	OutcomeError    = "error"
+	OutcomeNotFound = "not_found"
+	OutcomeFault    = "fault"
+)
+
+// request is an entry of the request journal, one per call
+type request struct {
+	// ID tells the entry apart, the generated server ends the call with it
+	ID int `json:"id"`
+	findStubPayload
+	Time time.Time `json:"time"`
+	// Duration is how long the whole call took, delays and streamed messages included,
+	// until the generated server was done answering it. unset while the call runs.
+	Duration *Duration `json:"duration,omitempty"`
+	// MatchDuration is how long finding the stub and rendering its output took.
+	MatchDuration Duration               `json:"match_duration"`
+	StubID        string                 `json:"stub_id,omitempty"`
+	Outcome       string                 `json:"outcome"`
+	Code          codes.Code             `json:"code"`
+	Response      map[string]interface{} `json:"response,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+
+	// ResponseStream is the messages sent by a streaming stub
+	ResponseStream []map[string]interface{} `json:"response_stream,omitempty"`
+}
+
+// storeRequest appends a call and its result to the journal. caller must hold mx.
+func storeRequest(stub *findStubPayload, start time.Time, strg *storage, output *Output, err error) {
+	req := &request{
+		findStubPayload: *stub,
+		Time:            start,
+		MatchDuration:   Duration(time.Since(start)),
+	}
+
+	if strg != nil {
+		req.StubID = strg.ID
+	}
+	if output != nil {
+		req.ResponseStream = output.Stream
+	}
+
+	switch {
+	case err != nil:
+		// the generated server passes the error through as is, which grpc reports as Unknown.
+		// the call ends right away.
+		req.Duration = &req.MatchDuration
+		req.Outcome = OutcomeNotFound
+		req.Code = codes.Unknown
+		req.Error = err.Error()
+	case output.fault:
+		req.Outcome = OutcomeFault
+		req.Code = codes.DeadlineExceeded
+		if output.Code != nil {
+			req.Code = *output.Code
+		}
+		req.Error = output.Error
+	case output.Error != "" || (output.Code != nil && *output.Code != codes.OK):
+		req.Outcome = OutcomeError
+		req.Code = codes.Aborted
+		if output.Code != nil {
+			req.Code = *output.Code
+		}
+		req.Error = output.Error
+	default:
+		req.Outcome = OutcomeMatched
+		req.Code = codes.OK
+		req.Response = output.Data
+	}
+
+	requestStorage.add(req)
+	if output != nil {
+		output.requestID = req.ID
+	}
+}
+
+// endRequest sets the duration of a call when the generated server tells it ended.
+// it returns false when the entry isn't in the journal anymore.
+func endRequest(id int, end time.Time) bool {
+	mx.Lock()
+	defer mx.Unlock()
+
+	req := requestStorage.find(id)
+	if req == nil {
+		return false
+	}
+	duration := Duration(end.Sub(req.Time))
+	req.Duration = &duration
+	return true
+}
+
+// journal is a ring buffer of requests bounded by number of entries and age.
+// zero limits mean unbounded. guarded by mx.
+type journal struct {
+	buf        []*request
+	head       int // index of the oldest entry
+	count      int
+	maxEntries int
+	maxAge     time.Duration
+	lastID     int // kept when cleared, so that ids aren't reused
+}
+
+func newJournal(maxEntries int, maxAge time.Duration) *journal {
+	return &journal{maxEntries: maxEntries, maxAge: maxAge}
+}
+
+func (j *journal) add(req *request) {
+	j.expire(req.Time)
+	j.lastID++
+	req.ID = j.lastID
+
+	switch {
+	case j.count < len(j.buf):
+		j.buf[(j.head+j.count)%len(j.buf)] = req
+		j.count++
+	case j.maxEntries > 0 && j.count >= j.maxEntries:
+		// full, overwrite the oldest entry
+		j.buf[j.head] = req
+		j.head = (j.head + 1) % len(j.buf)
+	default:
+		j.grow()
+		j.buf[j.count] = req
+		j.count++
+	}
+}
+
+// grow doubles the capacity of the ring, bounded by maxEntries, and moves the
+// oldest entry to the front
+func (j *journal) grow() {
+	size := 2 * len(j.buf)
+	if size < 16 {
+		size = 16
+	}
+	if j.maxEntries > 0 && size > j.maxEntries {
+		size = j.maxEntries
+	}
+
+	buf := make([]*request, size)
+	for i := 0; i < j.count; i++ {
+		buf[i] = j.buf[(j.head+i)%len(j.buf)]
+	}
+	j.buf = buf
+	j.head = 0
+}
+
+// expire drops the entries older than maxAge
+func (j *journal) expire(now time.Time) {
+	if j.maxAge <= 0 {
+		return
+	}
+	for j.count > 0 && now.Sub(j.buf[j.head].Time) > j.maxAge {
+		j.buf[j.head] = nil
+		j.head = (j.head + 1) % len(j.buf)
+		j.count--
+	}
+}
+
+// entries returns the requests from the oldest to the newest
+func (j *journal) entries() []*request {
+	j.expire(time.Now())
+	entries := make([]*request, 0, j.count)
+	for i := 0; i < j.count; i++ {
+		entries = append(entries, j.buf[(j.head+i)%len(j.buf)])
+	}
+	return entries
+}
+
+// find returns the entry with the given id, nil when it's gone
+func (j *journal) find(id int) *request {
+	for i := j.count - 1; i >= 0; i-- {
+		if req := j.buf[(j.head+i)%len(j.buf)]; req.ID == id {
+			return req
+		}
+	}
+	return nil
+}
+
+func (j *journal) clear() {
+	j.buf = nil
+	j.head = 0
+	j.count = 0
+}
+
+func configureJournal(maxEntries int, maxAge time.Duration) {
+	mx.Lock()
+	defer mx.Unlock()
+	requestStorage = newJournal(maxEntries, maxAge)
+}
+
+func clearRequests() {
+	mx.Lock()
+	defer mx.Unlock()
+	requestStorage.clear()
+}
+
+// requestFilter narrows down the journal. empty fields match everything.
+type requestFilter struct {
+	Service string
+	Method  string
+	Outcome string
+	Since   time.Time
+	Until   time.Time
+}
+
+// parseRequestFilter reads the filter from query parameters
+// service, method, outcome, since and until. times are RFC3339.
+func parseRequestFilter(query url.Values) (requestFilter, error) {
+	filter := requestFilter{
+		Service: query.Get("service"),
+		Method:  query.Get("method"),
+		Outcome: query.Get("outcome"),
+	}
+
+	switch filter.Outcome {
+	case "", OutcomeMatched, OutcomeError, OutcomeNotFound, OutcomeFault:
+	default:
+		return filter, fmt.Errorf("outcome must be one of %s, %s, %s or %s", OutcomeMatched, OutcomeError, OutcomeNotFound, OutcomeFault)
+	}
+
+	for param, dst := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: %v", param, err)
+		}
+		*dst = t
+	}
+
+	return filter, nil
+}
+
+func (f requestFilter) match(req *request) bool {
+	switch {
+	case f.Service != "" && req.Service != f.Service:
+		return false
+	case f.Method != "" && req.Method != f.Method:
+		return false
+	case f.Outcome != "" && req.Outcome != f.Outcome:
+		return false
+	case !f.Since.IsZero() && req.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && req.Time.After(f.Until):
+		return false
+	}
+	return true
+}
+
+func allRequests(filter requestFilter) []*request {
+	mx.Lock()
+	defer mx.Unlock()
+
+	requests := []*request{}
+	for _, req := range requestStorage.entries() {
+		if filter.match(req) {
+			requests = append(requests, req)
+		}
+	}
+	return requests
+}
@@ -0,0 +1,258 @@
+package stub
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func TestJournal(t *testing.T) {
+	clearStorage()
+	invalid := codes.InvalidArgument
+	require.NoError(t, storeStub(&Stub{
+		ID:      "ok-stub",
+		Service: "Orders",
+		Method:  "Get",
+		Input:   Input{Equals: map[string]interface{}{"id": "1"}},
+		Output:  Output{Data: map[string]interface{}{"id": "1"}},
+	}))
+	require.NoError(t, storeStub(&Stub{
+		ID:      "error-stub",
+		Service: "Orders",
+		Method:  "Create",
+		Input:   Input{Equals: map[string]interface{}{"id": "1"}},
+		Output:  Output{Error: "bad order", Code: &invalid},
+	}))
+
+	calls := []findStubPayload{
+		{Service: "Orders", Method: "Get", Data: map[string]interface{}{"id": "1"}, Headers: map[string]string{"x-tenant": "acme"}},
+		{Service: "Orders", Method: "Create", Data: map[string]interface{}{"id": "1"}},
+		{Service: "Orders", Method: "Get", Data: map[string]interface{}{"id": "2"}},
+	}
+	for i := range calls {
+		_, _ = findStub(&calls[i])
+	}
+
+	all := allRequests(requestFilter{})
+	require.Len(t, all, 3)
+
+	assert.Equal(t, "ok-stub", all[0].StubID)
+	assert.Equal(t, OutcomeMatched, all[0].Outcome)
+	assert.Equal(t, codes.OK, all[0].Code)
+	assert.Equal(t, map[string]string{"x-tenant": "acme"}, all[0].Headers)
+	assert.Equal(t, map[string]interface{}{"id": "1"}, all[0].Response)
+
+	assert.Equal(t, "error-stub", all[1].StubID)
+	assert.Equal(t, OutcomeError, all[1].Outcome)
+	assert.Equal(t, codes.InvalidArgument, all[1].Code)
+	assert.Equal(t, "bad order", all[1].Error)
+
+	assert.Empty(t, all[2].StubID)
+	assert.Equal(t, OutcomeNotFound, all[2].Outcome)
+	assert.Equal(t, codes.Unknown, all[2].Code)
+	assert.Contains(t, all[2].Error, "Can't find stub")
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{name: "by method", query: "method=Get", want: 2},
+		{name: "by service and outcome", query: "service=Orders&outcome=not_found", want: 1},
+		{name: "by unknown service", query: "service=Users", want: 0},
+		{name: "since", query: "since=" + url.QueryEscape(all[1].Time.Format(time.RFC3339Nano)), want: 2},
+		{name: "until", query: "until=" + url.QueryEscape(all[0].Time.Format(time.RFC3339Nano)), want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			listRequests(w, httptest.NewRequest("GET", "/requests?"+tt.query, nil))
+			require.Equal(t, 200, w.Code)
+
+			got := []request{}
+			require.NoError(t, json.NewDecoder(w.Result().Body).Decode(&got))
+			assert.Len(t, got, tt.want)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	listRequests(w, httptest.NewRequest("GET", "/requests?outcome=unknown", nil))
+	assert.Equal(t, 500, w.Code)
+}
+
+func TestEndRequest(t *testing.T) {
+	clearStorage()
+	require.NoError(t, storeStub(&Stub{
+		Service: "Orders",
+		Method:  "Get",
+		Input:   Input{Equals: map[string]interface{}{"id": "1"}},
+		Output:  Output{Data: map[string]interface{}{"id": "1"}},
+	}))
+
+	find := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handleFindStub(w, httptest.NewRequest("POST", "/find", strings.NewReader(body)))
+		return w
+	}
+	w := find(`{"service":"Orders","method":"Get","data":{"id":"1"}}`)
+	require.Equal(t, 200, w.Code)
+	id := w.Header().Get(requestIDHeader)
+	require.NotEmpty(t, id)
+
+	// the call is still running, e.g. waiting for its delay
+	req := allRequests(requestFilter{})[0]
+	assert.Equal(t, id, strconv.Itoa(req.ID))
+	assert.Nil(t, req.Duration)
+
+	time.Sleep(10 * time.Millisecond)
+	w = httptest.NewRecorder()
+	handleEndRequest(w, withURLParam(httptest.NewRequest("POST", "/requests/"+id+"/end", nil), "id", id))
+	require.Equal(t, 200, w.Code)
+	req = allRequests(requestFilter{})[0]
+	require.NotNil(t, req.Duration)
+	assert.GreaterOrEqual(t, time.Duration(*req.Duration), 10*time.Millisecond)
+	assert.Less(t, time.Duration(req.MatchDuration), time.Duration(*req.Duration))
+
+	// a call without stub ends as soon as it's looked up
+	w = find(`{"service":"Orders","method":"Get","data":{"id":"2"}}`)
+	require.NotEqual(t, 200, w.Code)
+	assert.Empty(t, w.Header().Get(requestIDHeader))
+	req = allRequests(requestFilter{})[1]
+	require.NotNil(t, req.Duration)
+	assert.Equal(t, req.MatchDuration, *req.Duration)
+
+	for _, id := range []string{"99", "abc"} {
+		w = httptest.NewRecorder()
+		handleEndRequest(w, withURLParam(httptest.NewRequest("POST", "/requests/"+id+"/end", nil), "id", id))
+		assert.NotEqual(t, 200, w.Code, id)
+	}
+
+	// ids aren't reused once the journal is cleared
+	clearRequests()
+	w = find(`{"service":"Orders","method":"Get","data":{"id":"1"}}`)
+	assert.NotEqual(t, id, w.Header().Get(requestIDHeader))
+}
+
+func TestDurationJSON(t *testing.T) {
+	var d struct {
+		Text   Duration `json:"text"`
+		Millis Duration `json:"millis"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(`{"text":"1.5s","millis":250}`), &d))
+	assert.Equal(t, Duration(1500*time.Millisecond), d.Text)
+	assert.Equal(t, Duration(250*time.Millisecond), d.Millis)
+
+	byt, err := json.Marshal(d)
+	require.NoError(t, err)
+	assert.Equal(t, `{"text":"1.5s","millis":"250ms"}`, string(byt))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"text":"soon"}`), &d))
+}
+
+func TestJournalRetention(t *testing.T) {
+	now := time.Now()
+	entry := func(method string, age time.Duration) *request {
+		return &request{
+			findStubPayload: findStubPayload{Service: "Orders", Method: method},
+			Time:            now.Add(-age),
+		}
+	}
+	methods := func(entries []*request) []string {
+		names := []string{}
+		for _, e := range entries {
+			names = append(names, e.Method)
+		}
+		return names
+	}
+
+	t.Run("max entries", func(t *testing.T) {
+		j := newJournal(3, 0)
+		for _, m := range []string{"A", "B", "C", "D", "E"} {
+			j.add(entry(m, 0))
+		}
+		assert.Equal(t, []string{"C", "D", "E"}, methods(j.entries()))
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		j := newJournal(0, time.Minute)
+		j.add(entry("A", 2*time.Minute))
+		j.add(entry("B", 30*time.Second))
+		j.add(entry("C", 0))
+		assert.Equal(t, []string{"B", "C"}, methods(j.entries()))
+	})
+
+	t.Run("unbounded", func(t *testing.T) {
+		j := newJournal(0, 0)
+		for i := 0; i < 100; i++ {
+			j.add(entry("A", 0))
+		}
+		assert.Len(t, j.entries(), 100)
+		// the ring doubles instead of growing by one entry
+		assert.Equal(t, 128, len(j.buf))
+	})
+
+	t.Run("grows after expiring", func(t *testing.T) {
+		j := newJournal(0, time.Minute)
+		for i := 0; i < 8; i++ {
+			j.add(entry("old", 2*time.Minute))
+		}
+		for i := 0; i < 8; i++ {
+			j.add(entry("kept", 0))
+		}
+		// the old entries expire, so the ring wraps around before growing
+		for _, m := range []string{"A", "B", "C", "D", "E", "F", "G", "H", "I", "J"} {
+			j.add(entry(m, 0))
+		}
+		got := methods(j.entries())
+		require.Len(t, got, 18)
+		assert.Equal(t, []string{"kept", "kept", "A", "B", "C", "D", "E", "F", "G", "H", "I", "J"}, got[6:])
+		assert.Equal(t, 32, len(j.buf))
+	})
+
+	t.Run("growth bounded by max entries", func(t *testing.T) {
+		j := newJournal(20, 0)
+		for i := 0; i < 50; i++ {
+			j.add(entry("A", 0))
+		}
+		assert.Len(t, j.entries(), 20)
+		assert.Equal(t, 20, len(j.buf))
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		j := newJournal(2, 0)
+		j.add(entry("A", 0))
+		j.clear()
+		assert.Empty(t, j.entries())
+		j.add(entry("B", 0))
+		assert.Equal(t, []string{"B"}, methods(j.entries()))
+	})
+}
+
+func TestClearRequests(t *testing.T) {
+	clearStorage()
+	require.NoError(t, storeStub(&Stub{
+		Service: "Orders",
+		Method:  "Get",
+		Input:   Input{Equals: map[string]interface{}{"id": "1"}},
+		Output:  Output{Data: map[string]interface{}{"id": "1"}},
+	}))
+	_, err := findStub(&findStubPayload{Service: "Orders", Method: "Get", Data: map[string]interface{}{"id": "1"}})
+	require.NoError(t, err)
+	require.Len(t, allRequests(requestFilter{}), 1)
+
+	w := httptest.NewRecorder()
+	handleClearRequests(w, httptest.NewRequest("DELETE", "/requests", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Empty(t, allRequests(requestFilter{}))
+
+	// stubs are left alone
+	assert.Len(t, allStub()["Orders"]["Get"], 1)
+}
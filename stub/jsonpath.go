@@ -0,0 +1,337 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// a subset of JSONPath used by the paths rule. supported syntax:
+//
+//	$                  root, optional: "order.lines" equals "$.order.lines"
+//	.name ['name']     object field
+//	[2] [-1]           array index, negative counts from the end
+//	[*] .*             every array element or object value
+//	[?(@.qty > 2)]     array elements passing a filter. operators are
+//	                   == != > >= < <=, or none to test the field exists
+type pathSegment struct {
+	kind   segmentKind
+	name   string
+	index  int
+	filter *pathFilter
+}
+
+type segmentKind int
+
+const (
+	segmentField segmentKind = iota
+	segmentIndex
+	segmentWildcard
+	segmentFilter
+)
+
+type pathFilter struct {
+	path  []pathSegment
+	op    string
+	value interface{}
+}
+
+var filterPattern = regexp.MustCompile(`^\?\(\s*@((?:\.[A-Za-z0-9_\-]+)*)\s*(?:(==|!=|>=|<=|>|<)\s*(.+?))?\s*\)$`)
+
+func parsePath(expr string) ([]pathSegment, error) {
+	rest := strings.TrimSpace(expr)
+	rest = strings.TrimPrefix(rest, "$")
+	if rest == "" {
+		return []pathSegment{}, nil
+	}
+	if !strings.HasPrefix(rest, ".") && !strings.HasPrefix(rest, "[") {
+		rest = "." + rest
+	}
+
+	segments := []pathSegment{}
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			rest = rest[end+1:]
+			if name == "" {
+				return nil, fmt.Errorf("invalid path %s: empty field name", expr)
+			}
+			if name == "*" {
+				segments = append(segments, pathSegment{kind: segmentWildcard})
+			} else {
+				segments = append(segments, pathSegment{kind: segmentField, name: name})
+			}
+		case '[':
+			end := closingBracket(rest)
+			if end == -1 {
+				return nil, fmt.Errorf("invalid path %s: missing ]", expr)
+			}
+			segment, err := parseBracket(strings.TrimSpace(rest[1:end]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid path %s: %v", expr, err)
+			}
+			segments = append(segments, segment)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("invalid path %s: unexpected %q", expr, rest[0])
+		}
+	}
+	return segments, nil
+}
+
+// closingBracket finds the ] closing the bracket at the start of s, skipping quoted strings
+func closingBracket(s string) int {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '\'' || s[i] == '"':
+			quote = s[i]
+		case s[i] == ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func parseBracket(content string) (pathSegment, error) {
+	switch {
+	case content == "*":
+		return pathSegment{kind: segmentWildcard}, nil
+	case len(content) >= 2 && (content[0] == '\'' || content[0] == '"') && content[len(content)-1] == content[0]:
+		return pathSegment{kind: segmentField, name: content[1 : len(content)-1]}, nil
+	case strings.HasPrefix(content, "?"):
+		filter, err := parseFilter(content)
+		if err != nil {
+			return pathSegment{}, err
+		}
+		return pathSegment{kind: segmentFilter, filter: filter}, nil
+	default:
+		index, err := strconv.Atoi(content)
+		if err != nil {
+			return pathSegment{}, fmt.Errorf("invalid index %s", content)
+		}
+		return pathSegment{kind: segmentIndex, index: index}, nil
+	}
+}
+
+func parseFilter(content string) (*pathFilter, error) {
+	groups := filterPattern.FindStringSubmatch(content)
+	if groups == nil {
+		return nil, fmt.Errorf("invalid filter %s", content)
+	}
+
+	path, err := parsePath(groups[1])
+	if err != nil {
+		return nil, err
+	}
+	filter := &pathFilter{path: path, op: groups[2]}
+	if filter.op == "" {
+		return filter, nil
+	}
+
+	literal := strings.TrimSpace(groups[3])
+	if strings.HasPrefix(literal, "'") && strings.HasSuffix(literal, "'") && len(literal) >= 2 {
+		filter.value = literal[1 : len(literal)-1]
+		return filter, nil
+	}
+	if err := json.Unmarshal([]byte(literal), &filter.value); err != nil {
+		return nil, fmt.Errorf("invalid filter value %s", literal)
+	}
+	return filter, nil
+}
+
+// selectPath returns every value the path points to
+func selectPath(segments []pathSegment, data interface{}) []interface{} {
+	values := []interface{}{data}
+	for _, segment := range segments {
+		next := []interface{}{}
+		for _, value := range values {
+			next = append(next, segment.apply(value)...)
+		}
+		values = next
+	}
+	return values
+}
+
+func (s pathSegment) apply(value interface{}) []interface{} {
+	switch s.kind {
+	case segmentField:
+		if object, ok := value.(map[string]interface{}); ok {
+			if item, ok := object[s.name]; ok {
+				return []interface{}{item}
+			}
+		}
+	case segmentIndex:
+		if array, ok := value.([]interface{}); ok {
+			index := s.index
+			if index < 0 {
+				index += len(array)
+			}
+			if index >= 0 && index < len(array) {
+				return []interface{}{array[index]}
+			}
+		}
+	case segmentWildcard:
+		switch v := value.(type) {
+		case []interface{}:
+			return v
+		case map[string]interface{}:
+			items := make([]interface{}, 0, len(v))
+			for _, item := range v {
+				items = append(items, item)
+			}
+			return items
+		}
+	case segmentFilter:
+		if array, ok := value.([]interface{}); ok {
+			items := []interface{}{}
+			for _, item := range array {
+				if s.filter.pass(item) {
+					items = append(items, item)
+				}
+			}
+			return items
+		}
+	}
+	return nil
+}
+
+func (f *pathFilter) pass(item interface{}) bool {
+	for _, value := range selectPath(f.path, item) {
+		if f.op == "" {
+			return true
+		}
+
+		if f.op == "==" || f.op == "!=" {
+			if pathValueEqual(value, f.value) == (f.op == "==") {
+				return true
+			}
+			continue
+		}
+
+		a, aOk := toNumber(value)
+		b, bOk := toNumber(f.value)
+		if !aOk || !bOk {
+			continue
+		}
+		cmp := a.Cmp(b)
+		switch {
+		case f.op == ">" && cmp > 0, f.op == ">=" && cmp >= 0, f.op == "<" && cmp < 0, f.op == "<=" && cmp <= 0:
+			return true
+		}
+	}
+	return false
+}
+
+// matchPaths checks every path of expect against the values it selects from actual.
+// a path passes when any selected value satisfies its expectation, which is either
+// a plain value to be equal to, {"matches": "<regex>"}, {"exists": <bool>}
+// or the numeric operators of the compare rule.
+func matchPaths(expect, actual map[string]interface{}) bool {
+	for expr, expected := range expect {
+		segments, err := parsePath(expr)
+		if err != nil {
+			log.Printf("Error on parsing path %s error:%v\n", expr, err)
+			return false
+		}
+		check, err := newPathCheck(expected)
+		if err != nil {
+			log.Printf("Error on parsing expectation of path %s error:%v\n", expr, err)
+			return false
+		}
+		if !check(selectPath(segments, actual)) {
+			return false
+		}
+	}
+	return true
+}
+
+func validatePaths(expect map[string]interface{}) error {
+	for expr, expected := range expect {
+		if _, err := parsePath(expr); err != nil {
+			return err
+		}
+		if _, err := newPathCheck(expected); err != nil {
+			return fmt.Errorf("%s: %v", expr, err)
+		}
+	}
+	return nil
+}
+
+// newPathCheck builds the check of the values selected by a path
+func newPathCheck(expected interface{}) (func(values []interface{}) bool, error) {
+	anyValue := func(match func(value interface{}) bool) func(values []interface{}) bool {
+		return func(values []interface{}) bool {
+			for _, value := range values {
+				if match(value) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	object, ok := expected.(map[string]interface{})
+	switch {
+	case ok && len(object) == 1 && object["exists"] != nil:
+		exists, ok := object["exists"].(bool)
+		if !ok {
+			return nil, fmt.Errorf("exists expects a boolean")
+		}
+		return func(values []interface{}) bool {
+			return (len(values) > 0) == exists
+		}, nil
+	case ok && len(object) == 1 && object["matches"] != nil:
+		pattern, ok := object["matches"].(string)
+		if !ok {
+			return nil, fmt.Errorf("matches expects a string")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return anyValue(func(value interface{}) bool {
+			str, ok := value.(string)
+			return ok && re.MatchString(str)
+		}), nil
+	case ok && isComparison(object):
+		cmp, err := newComparison(object)
+		if err != nil {
+			return nil, err
+		}
+		return anyValue(func(value interface{}) bool {
+			return compareMatch(cmp, value)
+		}), nil
+	default:
+		return anyValue(func(value interface{}) bool {
+			return pathValueEqual(value, expected)
+		}), nil
+	}
+}
+
+// pathValueEqual tells whether a value equals the expected one. an expected number also
+// equals the string encoded numbers of protobuf JSON, but an expected string only equals
+// the same string, "01234" isn't "1234".
+func pathValueEqual(value, expected interface{}) bool {
+	if _, ok := expected.(float64); ok {
+		if a, aOk := toNumber(value); aOk {
+			if b, bOk := toNumber(expected); bOk {
+				return a.Cmp(b) == 0
+			}
+		}
+	}
+	return reflect.DeepEqual(value, expected)
+}
@@ -0,0 +1,113 @@
+package stub
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pathTestData = `{
+	"order": {
+		"id": "9007199254740993",
+		"customer": {"name": "Jane", "tier": "gold"},
+		"lines": [
+			{"sku": "A-1", "qty": 1, "tags": ["promo"]},
+			{"sku": "B-2", "qty": 3},
+			{"sku": "C-3", "qty": 5}
+		]
+	},
+	"items": [{"sku": "X"}, {"sku": "Y"}],
+	"codes": [{"sku": "010", "n": 1}, {"sku": "10", "n": 2}, {"sku": 10, "n": 3}],
+	"zip": "01234",
+	"odd key": true
+}`
+
+func Test_selectPath(t *testing.T) {
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(pathTestData), &data))
+
+	tests := []struct {
+		path string
+		want []interface{}
+	}{
+		{path: "$.order.customer.name", want: []interface{}{"Jane"}},
+		{path: "order.customer.name", want: []interface{}{"Jane"}},
+		{path: "order.lines[2].qty", want: []interface{}{float64(5)}},
+		{path: "order.lines[-1].sku", want: []interface{}{"C-3"}},
+		{path: "$.items[*].sku", want: []interface{}{"X", "Y"}},
+		{path: "$['odd key']", want: []interface{}{true}},
+		{path: "$.order.lines[?(@.qty > 2)].sku", want: []interface{}{"B-2", "C-3"}},
+		{path: "$.order.lines[?(@.sku == 'A-1')].qty", want: []interface{}{float64(1)}},
+		{path: "$.codes[?(@.sku == '10')].n", want: []interface{}{float64(2)}},
+		{path: "$.codes[?(@.sku != '10')].n", want: []interface{}{float64(1), float64(3)}},
+		{path: "$.codes[?(@.sku == 10)].n", want: []interface{}{float64(1), float64(2), float64(3)}},
+		{path: "$.order.lines[?(@.tags)].sku", want: []interface{}{"A-1"}},
+		{path: "$.order.customer.*", want: nil},
+		{path: "$.order.lines[5].sku", want: []interface{}{}},
+		{path: "$.missing.field", want: []interface{}{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			segments, err := parsePath(tt.path)
+			require.NoError(t, err)
+			got := selectPath(segments, data)
+			if tt.want == nil {
+				assert.ElementsMatch(t, []interface{}{"Jane", "gold"}, got)
+				return
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_parsePathInvalid(t *testing.T) {
+	for _, path := range []string{"$.order[", "$.order[abc]", "$..order", "$.order[?(qty > 1)]", "$.order[?(@.qty > 'x)]"} {
+		_, err := parsePath(path)
+		assert.Error(t, err, path)
+	}
+}
+
+func Test_matchPaths(t *testing.T) {
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(pathTestData), &data))
+
+	tests := []struct {
+		name   string
+		expect string
+		want   bool
+	}{
+		{name: "any element has sku", expect: `{"$.items[*].sku": "Y"}`, want: true},
+		{name: "no element has sku", expect: `{"$.items[*].sku": "Z"}`, want: false},
+		{name: "positional", expect: `{"order.lines[2].qty": 5}`, want: true},
+		{name: "string encoded int64", expect: `{"order.id": 9007199254740993}`, want: false},
+		{name: "string", expect: `{"zip": "01234"}`, want: true},
+		{name: "strings aren't numbers", expect: `{"zip": "1234"}`, want: false},
+		{name: "number equals string encoded number", expect: `{"$.codes[0].sku": 10}`, want: true},
+		{name: "string encoded int64 compared", expect: `{"order.id": {"gte": "9007199254740993"}}`, want: true},
+		{name: "comparison", expect: `{"order.lines[*].qty": {"gt": 4}}`, want: true},
+		{name: "regex", expect: `{"order.customer.name": {"matches": "^J"}}`, want: true},
+		{name: "exists", expect: `{"order.customer.tier": {"exists": true}}`, want: true},
+		{name: "not exists", expect: `{"order.customer.email": {"exists": false}}`, want: true},
+		{name: "filter", expect: `{"$.order.lines[?(@.sku == 'B-2')].qty": 3}`, want: true},
+		{name: "every path must pass", expect: `{"$.items[*].sku": "X", "order.customer.name": "John"}`, want: false},
+		{name: "object value", expect: `{"order.customer": {"name": "Jane", "tier": "gold"}}`, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var expect map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(tt.expect), &expect))
+			require.NoError(t, validatePaths(expect))
+			assert.Equal(t, tt.want, matchPaths(expect, data))
+		})
+	}
+}
+
+func Test_validatePaths(t *testing.T) {
+	assert.Error(t, validatePaths(map[string]interface{}{"$.items[": "X"}))
+	assert.Error(t, validatePaths(map[string]interface{}{"$.name": map[string]interface{}{"matches": "("}}))
+	assert.Error(t, validatePaths(map[string]interface{}{"$.name": map[string]interface{}{"exists": "yes"}}))
+}
@@ -0,0 +1,93 @@
+package stub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+)
+
+// loadError is a stub file, or a stub of a file, that couldn't be loaded
+type loadError struct {
+	File string `json:"file"`
+	// Index is the position of the stub in the file, unset when the whole file failed
+	Index *int `json:"index,omitempty"`
+	// Line is where the error is in the file, when known
+	Line   int    `json:"line,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (e *loadError) Error() string {
+	location := e.File
+	if e.Line > 0 {
+		location = fmt.Sprintf("%s:%d", location, e.Line)
+	}
+	if e.Index != nil {
+		location = fmt.Sprintf("%s: stub %d", location, *e.Index)
+	}
+	return location + ": " + e.Reason
+}
+
+// loadErrors are the errors of the last load of the stub files, by file. guarded by mx.
+var loadErrors = map[string][]*loadError{}
+
+// clearLoadErrors forgets the errors of a file, or of every file when file is empty
+func clearLoadErrors(file string) {
+	mx.Lock()
+	defer mx.Unlock()
+	if file == "" {
+		loadErrors = map[string][]*loadError{}
+		return
+	}
+	delete(loadErrors, file)
+}
+
+// allLoadErrors returns the load errors ordered by file, then by position in the file
+func allLoadErrors() []*loadError {
+	mx.Lock()
+	defer mx.Unlock()
+
+	files := make([]string, 0, len(loadErrors))
+	for file := range loadErrors {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	errs := []*loadError{}
+	for _, file := range files {
+		errs = append(errs, loadErrors[file]...)
+	}
+	return errs
+}
+
+// jsonErrorLine finds the line of a json decoding error in the decoded file
+func jsonErrorLine(byt []byte, err error) int {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return 0
+	}
+
+	line := 1
+	for i := int64(0); i < offset && i < int64(len(byt)); i++ {
+		if byt[i] == '\n' {
+			line++
+		}
+	}
+	return line
+}
+
+func handleLoadErrors(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(allLoadErrors()); err != nil {
+		log.Println("Error writing handleLoadErrors response:", err)
+	}
+}
@@ -0,0 +1,69 @@
+package stub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_readStubFromFileLoadErrors(t *testing.T) {
+	clearStorage()
+	dir := t.TempDir()
+	files := map[string]string{
+		"users.json": `[
+  {"service":"user","method":"GetName","input":{"equals":{"id":1}},"output":{"data":{"name":"user1"}}},
+  {"service":"user","input":{"equals":{"id":2}},"output":{"data":{"name":"user2"}}}
+]`,
+		"broken.json": "{\n  \"service\":\"user\",\n  \"method\" \"GetName\"\n}",
+		"orders.yaml": "service: order\nmethod: GetOrder\ninput: {equals: {id: 1}}\noutput: {}\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+
+	require.Equal(t, 1, readStubFromFile(dir))
+
+	one := 1
+	zero := 0
+	assert.Equal(t, []*loadError{
+		{File: filepath.Join(dir, "broken.json"), Line: 3, Reason: "invalid character '\"' after object key"},
+		{File: filepath.Join(dir, "orders.yaml"), Index: &zero, Line: 1, Reason: "Output can't be empty"},
+		{File: filepath.Join(dir, "users.json"), Index: &one, Reason: "method name can't be emtpy"},
+	}, allLoadErrors())
+
+	res := httptest.NewRecorder()
+	handleLoadErrors(res, httptest.NewRequest(http.MethodGet, "/load-errors", nil))
+	var got []map[string]interface{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+	require.Len(t, got, 3)
+	assert.NotContains(t, got[0], "index")
+	assert.Equal(t, float64(1), got[2]["index"])
+
+	// fixing a file drops its errors only
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"service":"user","method":"GetName","input":{"equals":{"id":3}},"output":{"data":{}}}`), 0o644))
+	reloadStubFile(filepath.Join(dir, "broken.json"), true)
+	assert.Len(t, allLoadErrors(), 2)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "orders.yaml")))
+	reloadStubFile(filepath.Join(dir, "orders.yaml"), false)
+	assert.Len(t, allLoadErrors(), 1)
+
+	// a new load starts over
+	require.NoError(t, os.Remove(filepath.Join(dir, "users.json")))
+	clearStorage()
+	readStubFromFile(dir)
+	assert.Empty(t, allLoadErrors())
+}
+
+func Test_loadErrorError(t *testing.T) {
+	index := 2
+	assert.Equal(t, "stubs.json: stub 2: method name can't be emtpy", (&loadError{File: "stubs.json", Index: &index, Reason: "method name can't be emtpy"}).Error())
+	assert.Equal(t, "stubs.yaml:4: stub 2: Output can't be empty", (&loadError{File: "stubs.yaml", Index: &index, Line: 4, Reason: "Output can't be empty"}).Error())
+	assert.Equal(t, "stubs.json:3: invalid character", (&loadError{File: "stubs.json", Line: 3, Reason: "invalid character"}).Error())
+}
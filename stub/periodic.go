@@ -0,0 +1,55 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Periodic keeps a server stream sending messages every Interval, cycling through
+// the output stream (or sending its data), until the client cancels or MaxCount
+// messages were sent or MaxDuration passed. zero limits mean unlimited.
+type Periodic struct {
+	Interval    Duration `json:"interval"`
+	MaxCount    int      `json:"max_count,omitempty"`
+	MaxDuration Duration `json:"max_duration,omitempty"`
+}
+
+func (p Periodic) validate() error {
+	if p.Interval <= 0 {
+		return fmt.Errorf("periodic interval must be positive")
+	}
+	if p.MaxCount < 0 || p.MaxDuration < 0 {
+		return fmt.Errorf("periodic max_count and max_duration can't be negative")
+	}
+	return nil
+}
+
+// renderPayload asks for a message of a periodic stream
+type renderPayload struct {
+	findStubPayload
+	Message map[string]interface{} `json:"message"`
+	Seq     int                    `json:"seq"`
+}
+
+func handleRender(w http.ResponseWriter, r *http.Request) {
+	payload := renderPayload{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		responseError(err, w)
+		return
+	}
+
+	mx.Lock()
+	message, err := renderMessage(payload.Message, &payload.findStubPayload, payload.Seq)
+	mx.Unlock()
+	if err != nil {
+		responseError(err, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(message); err != nil {
+		log.Println("Error writing handleRender response:", err)
+	}
+}
@@ -0,0 +1,77 @@
+package stub
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_findStubPeriodic(t *testing.T) {
+	clearStorage()
+	stub := &Stub{
+		Service: "Prices",
+		Method:  "Watch",
+		Input:   Input{Equals: map[string]interface{}{"symbol": "ACME"}},
+		Output: Output{
+			Stream:   []map[string]interface{}{{"tick": "{{ .Seq }} {{ .Request.symbol }}"}},
+			Periodic: &Periodic{Interval: Duration(time.Second), MaxCount: 10},
+			Headers:  map[string]string{"x-symbol": "{{ .Request.symbol }}"},
+		},
+	}
+	require.NoError(t, validateStub(stub))
+	require.NoError(t, storeStub(stub))
+
+	got, err := findStub(&findStubPayload{Service: "Prices", Method: "Watch", Data: map[string]interface{}{"symbol": "ACME"}})
+	require.NoError(t, err)
+	// messages are rendered on every tick, the rest of the output right away
+	assert.Equal(t, "{{ .Seq }} {{ .Request.symbol }}", got.Stream[0]["tick"])
+	assert.Equal(t, "ACME", got.Headers["x-symbol"])
+	assert.Equal(t, 10, got.Periodic.MaxCount)
+}
+
+func Test_handleRender(t *testing.T) {
+	body := []byte(`{"service":"Prices","method":"Watch","data":{"symbol":"ACME"},"message":{"tick":"{{ .Seq }}-{{ .Request.symbol }}"},"seq":3}`)
+	res := httptest.NewRecorder()
+	handleRender(res, httptest.NewRequest(http.MethodPost, "/render", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, res.Code)
+
+	message := map[string]interface{}{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&message))
+	assert.Equal(t, "3-ACME", message["tick"])
+
+	body = []byte(`{"service":"Prices","method":"Watch","data":{},"message":{"tick":"{{ .Request.symbol }}"},"seq":1}`)
+	res = httptest.NewRecorder()
+	handleRender(res, httptest.NewRequest(http.MethodPost, "/render", bytes.NewReader(body)))
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+}
+
+func TestPeriodicValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		periodic Periodic
+		wantErr  string
+	}{
+		{name: "valid", periodic: Periodic{Interval: Duration(time.Second)}},
+		{name: "with limits", periodic: Periodic{Interval: Duration(time.Second), MaxCount: 5, MaxDuration: Duration(time.Minute)}},
+		{name: "no interval", periodic: Periodic{}, wantErr: "interval must be positive"},
+		{name: "negative max_count", periodic: Periodic{Interval: Duration(time.Second), MaxCount: -1}, wantErr: "can't be negative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.periodic.validate()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
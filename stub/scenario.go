@@ -0,0 +1,119 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/go-chi/chi"
+)
+
+// ScenarioStarted is the state every scenario begins in
+const ScenarioStarted = "Started"
+
+// scenarioStates holds the current state of each scenario, keyed by scenario name.
+// scenarios that aren't in the map are in ScenarioStarted state. guarded by mx.
+var scenarioStates = map[string]string{}
+
+type scenario struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// scenarioState returns the current state of a scenario. caller must hold mx.
+func scenarioState(name string) string {
+	if state, ok := scenarioStates[name]; ok {
+		return state
+	}
+	return ScenarioStarted
+}
+
+// inRequiredState tells whether the stub's scenario allows it to be considered.
+// caller must hold mx.
+func (s *storage) inRequiredState() bool {
+	return s.RequiredState == "" || scenarioState(s.Scenario) == s.RequiredState
+}
+
+// transitionScenario moves the stub's scenario to its new state, if any.
+// caller must hold mx.
+func (s *storage) transitionScenario() {
+	if s.NewState != "" {
+		scenarioStates[s.Scenario] = s.NewState
+	}
+}
+
+// allScenarios lists every scenario referenced by a stub or set through the api
+func allScenarios() []scenario {
+	mx.Lock()
+	defer mx.Unlock()
+
+	names := map[string]bool{}
+	for name := range scenarioStates {
+		names[name] = true
+	}
+	for _, methods := range stubStorage {
+		for _, stubs := range methods {
+			for _, strg := range stubs {
+				if strg.Scenario != "" {
+					names[strg.Scenario] = true
+				}
+			}
+		}
+	}
+
+	scenarios := make([]scenario, 0, len(names))
+	for name := range names {
+		scenarios = append(scenarios, scenario{Name: name, State: scenarioState(name)})
+	}
+	sort.Slice(scenarios, func(i, j int) bool {
+		return scenarios[i].Name < scenarios[j].Name
+	})
+	return scenarios
+}
+
+func setScenarioState(name, state string) {
+	mx.Lock()
+	defer mx.Unlock()
+	scenarioStates[name] = state
+}
+
+func resetScenarios() {
+	mx.Lock()
+	defer mx.Unlock()
+	scenarioStates = map[string]string{}
+}
+
+func listScenarios(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(allScenarios()); err != nil {
+		log.Println("Error writing listScenarios response: %w", err)
+	}
+}
+
+func handleSetScenarioState(w http.ResponseWriter, r *http.Request) {
+	body := new(scenario)
+	err := json.NewDecoder(r.Body).Decode(body)
+	if err != nil {
+		responseError(err, w)
+		return
+	}
+
+	if body.State == "" {
+		responseError(fmt.Errorf("state can't be empty"), w)
+		return
+	}
+
+	setScenarioState(chi.URLParam(r, "name"), body.State)
+	if _, err := w.Write([]byte("OK")); err != nil {
+		log.Println("Error writing handleSetScenarioState response: %w", err)
+	}
+}
+
+func handleResetScenarios(w http.ResponseWriter, r *http.Request) {
+	resetScenarios()
+	if _, err := w.Write([]byte("OK")); err != nil {
+		log.Println("Error writing handleResetScenarios response: %w", err)
+	}
+}
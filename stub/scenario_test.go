@@ -0,0 +1,122 @@
+package stub
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func Test_findStubScenario(t *testing.T) {
+	clearStorage()
+	notFound := codes.NotFound
+	stubs := []*Stub{
+		{
+			Method:   "GetItem",
+			Input:    Input{Equals: map[string]interface{}{"id": "1"}},
+			Output:   Output{Error: "item not found", Code: &notFound},
+			Scenario: "item", RequiredState: ScenarioStarted,
+		},
+		{
+			Method:   "CreateItem",
+			Input:    Input{Equals: map[string]interface{}{"id": "1"}},
+			Output:   Output{Data: map[string]interface{}{"id": "1"}},
+			Scenario: "item", RequiredState: ScenarioStarted, NewState: "created",
+		},
+		{
+			Method:   "GetItem",
+			Input:    Input{Equals: map[string]interface{}{"id": "1"}},
+			Output:   Output{Data: map[string]interface{}{"id": "1"}},
+			Scenario: "item", RequiredState: "created",
+		},
+		{
+			Method:   "DeleteItem",
+			Input:    Input{Equals: map[string]interface{}{"id": "1"}},
+			Output:   Output{Data: map[string]interface{}{}},
+			Scenario: "item", RequiredState: "created", NewState: "deleted",
+		},
+		{
+			Method:   "GetItem",
+			Input:    Input{Equals: map[string]interface{}{"id": "1"}},
+			Output:   Output{Error: "item deleted", Code: &notFound},
+			Scenario: "item", RequiredState: "deleted",
+		},
+	}
+	for _, s := range stubs {
+		s.Service = "Items"
+		require.NoError(t, storeStub(s))
+	}
+
+	call := func(method string) *Output {
+		out, err := findStub(&findStubPayload{
+			Service: "Items",
+			Method:  method,
+			Data:    map[string]interface{}{"id": "1"},
+		})
+		require.NoError(t, err)
+		return out
+	}
+
+	assert.Equal(t, "item not found", call("GetItem").Error)
+	assert.Equal(t, map[string]interface{}{"id": "1"}, call("CreateItem").Data)
+	assert.Equal(t, map[string]interface{}{"id": "1"}, call("GetItem").Data)
+	assert.Equal(t, []scenario{{Name: "item", State: "created"}}, allScenarios())
+	call("DeleteItem")
+	assert.Equal(t, "item deleted", call("GetItem").Error)
+
+	// create is only allowed from the started state
+	_, err := findStub(&findStubPayload{
+		Service: "Items",
+		Method:  "CreateItem",
+		Data:    map[string]interface{}{"id": "1"},
+	})
+	require.Error(t, err)
+
+	resetScenarios()
+	assert.Equal(t, "item not found", call("GetItem").Error)
+}
+
+func TestScenarioHandlers(t *testing.T) {
+	clearStorage()
+	require.NoError(t, storeStub(&Stub{
+		Service:  "Items",
+		Method:   "GetItem",
+		Input:    Input{Equals: map[string]interface{}{"id": "1"}},
+		Output:   Output{Data: map[string]interface{}{"id": "1"}},
+		Scenario: "item", RequiredState: "created",
+	}))
+
+	read := func(w *httptest.ResponseRecorder) string {
+		res, err := ioutil.ReadAll(w.Result().Body)
+		require.NoError(t, err)
+		return string(res)
+	}
+
+	w := httptest.NewRecorder()
+	listScenarios(w, httptest.NewRequest("GET", "/scenarios", nil))
+	assert.Equal(t, "[{\"name\":\"item\",\"state\":\"Started\"}]\n", read(w))
+
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", "/scenarios/item/state", bytes.NewReader([]byte(`{"state":"created"}`)))
+	handleSetScenarioState(w, withURLParam(req, "name", "item"))
+	assert.Equal(t, "OK", read(w))
+
+	w = httptest.NewRecorder()
+	listScenarios(w, httptest.NewRequest("GET", "/scenarios", nil))
+	assert.Equal(t, "[{\"name\":\"item\",\"state\":\"created\"}]\n", read(w))
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("PUT", "/scenarios/item/state", bytes.NewReader([]byte(`{}`)))
+	handleSetScenarioState(w, withURLParam(req, "name", "item"))
+	assert.Equal(t, 500, w.Code)
+	assert.Equal(t, "state can't be empty", read(w))
+
+	w = httptest.NewRecorder()
+	handleResetScenarios(w, httptest.NewRequest("POST", "/scenarios/reset", nil))
+	assert.Equal(t, "OK", read(w))
+	assert.Equal(t, []scenario{{Name: "item", State: ScenarioStarted}}, allScenarios())
+}
@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/lithammer/fuzzysearch/fuzzy"
 )
 
@@ -22,43 +25,129 @@ type stubMapping map[string]map[string][]storage
 type matchFunc func(interface{}, interface{}) bool
 
 var stubStorage = stubMapping{}
-var requestStorage = []*request{}
+var requestStorage = newJournal(DEFAULT_JOURNAL_MAX_ENTRIES, 0)
+
+// stubCalls counts how many times each stub has responded, keyed by stub id.
+// it is the cursor of sequenced outputs as well as the counter of times limits,
+// and is guarded by mx like stubStorage.
+var stubCalls = map[string]int{}
 
 type storage struct {
-	Input  Input
-	Output Output
+	ID          string
+	Priority    int `json:",omitempty"`
+	Times       int `json:",omitempty"`
+	Input       Input
+	Output      Output
+	Outputs     []Output `json:",omitempty"`
+	OnExhausted string   `json:",omitempty"`
+
+	Scenario      string `json:",omitempty"`
+	RequiredState string `json:",omitempty"`
+	NewState      string `json:",omitempty"`
+
+	Faults       []Fault       `json:",omitempty"`
+	Conversation *Conversation `json:",omitempty"`
+
+	// Source is the file the stub was loaded from, empty for the stubs added through the API
+	Source string `json:",omitempty"`
 }
 
-type request struct {
-	Record findStubPayload `json:"record"`
-	Count  int             `json:"count"`
+func newStorage(stub *Stub) storage {
+	return storage{
+		ID:          stub.ID,
+		Priority:    stub.Priority,
+		Times:       stub.Times,
+		Input:       stub.Input,
+		Output:      stub.Output,
+		Outputs:     stub.Outputs,
+		OnExhausted: stub.OnExhausted,
+
+		Scenario:      stub.Scenario,
+		RequiredState: stub.RequiredState,
+		NewState:      stub.NewState,
+
+		Faults:       stub.Faults,
+		Conversation: stub.Conversation,
+
+		Source: stub.source,
+	}
 }
 
-func storeStub(stub *Stub) error {
-	return stubStorage.storeStub(stub)
+func (s storage) stub(service, method string) *Stub {
+	return &Stub{
+		ID:          s.ID,
+		Service:     service,
+		Method:      method,
+		Priority:    s.Priority,
+		Times:       s.Times,
+		Input:       s.Input,
+		Output:      s.Output,
+		Outputs:     s.Outputs,
+		OnExhausted: s.OnExhausted,
+
+		Scenario:      s.Scenario,
+		RequiredState: s.RequiredState,
+		NewState:      s.NewState,
+
+		Faults:       s.Faults,
+		Conversation: s.Conversation,
+
+		source: s.Source,
+	}
 }
 
-func storeRequest(stub *findStubPayload) {
-	for _, v := range requestStorage {
-		if reflect.DeepEqual(v.Record, *stub) {
-			v.Count++
-			return
-		}
+// expired tells whether the stub already responded as many times as it's allowed to
+func (s *storage) expired(calls int) bool {
+	return s.Times > 0 && calls >= s.Times
+}
+
+// nextOutput returns the output for the given number of previous calls.
+// it returns false when the sequence is exhausted and the stub should be skipped.
+func (s *storage) nextOutput(calls int) (*Output, bool) {
+	if len(s.Outputs) == 0 {
+		return &s.Output, true
 	}
-	requestStorage = append(requestStorage, &request{
-		Record: *stub,
-		Count:  1,
-	})
+
+	if calls < len(s.Outputs) {
+		return &s.Outputs[calls], true
+	}
+
+	switch s.OnExhausted {
+	case OnExhaustedCycle:
+		return &s.Outputs[calls%len(s.Outputs)], true
+	case OnExhaustedFallthrough:
+		return nil, false
+	default:
+		return &s.Outputs[len(s.Outputs)-1], true
+	}
+}
+
+func storeStub(stub *Stub) error {
+	return stubStorage.storeStub(stub)
 }
 
 func (sm *stubMapping) storeStub(stub *Stub) error {
 	mx.Lock()
 	defer mx.Unlock()
+	return sm.store(stub)
+}
+
+// store adds a stub to the mapping. caller must hold mx.
+func (sm *stubMapping) store(stub *Stub) error {
+	if stub.ID == "" {
+		stub.ID = uuid.NewString()
+	} else if _, _, _, ok := sm.findByID(stub.ID); ok {
+		return fmt.Errorf("stub with id %s already exists", stub.ID)
+	}
 
-	strg := storage{
-		Input:  stub.Input,
-		Output: stub.Output,
+	if err := compileExprs(stub.Input); err != nil {
+		return err
+	}
+	if err := compileStubTemplates(stub); err != nil {
+		return err
 	}
+
+	strg := newStorage(stub)
 	if (*sm)[stub.Service] == nil {
 		(*sm)[stub.Service] = make(map[string][]storage)
 	}
@@ -66,16 +155,103 @@ func (sm *stubMapping) storeStub(stub *Stub) error {
 	return nil
 }
 
-func allStub() stubMapping {
+// findByID returns the location of the stub with the given id.
+// caller must hold mx.
+func (sm *stubMapping) findByID(id string) (service, method string, index int, ok bool) {
+	for service, methods := range *sm {
+		for method, stubs := range methods {
+			for i, strg := range stubs {
+				if strg.ID == id {
+					return service, method, i, true
+				}
+			}
+		}
+	}
+	return "", "", 0, false
+}
+
+func getStub(id string) (*Stub, bool) {
+	mx.Lock()
+	defer mx.Unlock()
+
+	service, method, index, ok := stubStorage.findByID(id)
+	if !ok {
+		return nil, false
+	}
+	return stubStorage[service][method][index].stub(service, method), true
+}
+
+// updateStub replaces the stub with the given id, keeping its position
+// when service and method are unchanged.
+func updateStub(id string, stub *Stub) bool {
+	mx.Lock()
+	defer mx.Unlock()
+
+	service, method, index, ok := stubStorage.findByID(id)
+	if !ok {
+		return false
+	}
+
+	stub.ID = id
+	strg := newStorage(stub)
+	delete(stubCalls, id)
+	if service == stub.Service && method == stub.Method {
+		stubStorage[service][method][index] = strg
+		return true
+	}
+
+	stubStorage.remove(service, method, index)
+	if stubStorage[stub.Service] == nil {
+		stubStorage[stub.Service] = make(map[string][]storage)
+	}
+	stubStorage[stub.Service][stub.Method] = append(stubStorage[stub.Service][stub.Method], strg)
+	return true
+}
+
+func deleteStub(id string) bool {
 	mx.Lock()
 	defer mx.Unlock()
-	return stubStorage
+
+	service, method, index, ok := stubStorage.findByID(id)
+	if !ok {
+		return false
+	}
+	stubStorage.remove(service, method, index)
+	delete(stubCalls, id)
+	return true
 }
 
-func allRequests() []*request {
+// remove drops a stub and any service or method entry left empty by it.
+// caller must hold mx.
+func (sm *stubMapping) remove(service, method string, index int) {
+	stubs := (*sm)[service][method]
+	stubs = append(stubs[:index:index], stubs[index+1:]...)
+	if len(stubs) > 0 {
+		(*sm)[service][method] = stubs
+		return
+	}
+
+	delete((*sm)[service], method)
+	if len((*sm)[service]) == 0 {
+		delete(*sm, service)
+	}
+}
+
+// allStub returns a copy of the stubs, which the caller can read while they're
+// changed, e.g. by --watch. stored stubs are replaced rather than modified, so copying
+// the maps and slices is enough.
+func allStub() stubMapping {
 	mx.Lock()
 	defer mx.Unlock()
-	return requestStorage
+
+	copied := make(stubMapping, len(stubStorage))
+	for service, methods := range stubStorage {
+		copied[service] = make(map[string][]storage, len(methods))
+		for method, stubs := range methods {
+			copied[service][method] = append([]storage(nil), stubs...)
+		}
+	}
+	return copied
 }
 
 type closeMatch struct {
@@ -88,64 +264,303 @@ type closeMatch struct {
 func findStub(stub *findStubPayload) (*Output, error) {
 	mx.Lock()
 	defer mx.Unlock()
-	storeRequest(stub)
+
+	start := time.Now()
+	if stub.Event == "" {
+		if output, ok := injectFault(chaosConfig.Faults); ok {
+			storeRequest(stub, start, nil, output, nil)
+			return output, nil
+		}
+	}
+
+	strg, output, err := matchStub(stub)
+	if err != nil && stub.Event == EventOpen {
+		// streams without a conversation are answered message by message
+		return &Output{}, nil
+	}
+	if err == nil {
+		output, err = renderOutput(output, stub)
+	}
+	if err == nil && strg.Conversation != nil {
+		output.conversation, err = strg.Conversation.render(stub)
+	}
+	if err == nil {
+		output.Delay = output.Delay.sample()
+		output.streamDelays = output.StreamDelay.sampleEach(len(output.Stream) - 1)
+	}
+	storeRequest(stub, start, strg, output, err)
+	return output, err
+}
+
+// matchStub picks the stub responding to the request. caller must hold mx.
+func matchStub(stub *findStubPayload) (*storage, *Output, error) {
 	if _, ok := stubStorage[stub.Service]; !ok {
-		return nil, fmt.Errorf("can't find stub for Service: %s", stub.Service)
+		return nil, nil, fmt.Errorf("can't find stub for Service: %s", stub.Service)
 	}
 
 	if _, ok := stubStorage[stub.Service][stub.Method]; !ok {
-		return nil, fmt.Errorf("can't find stub for Service:%s and Method:%s", stub.Service, stub.Method)
+		return nil, nil, fmt.Errorf("can't find stub for Service:%s and Method:%s", stub.Service, stub.Method)
 	}
 
 	stubs := stubStorage[stub.Service][stub.Method]
 	if len(stubs) == 0 {
-		return nil, fmt.Errorf("Stub for Service:%s and Method:%s is empty", stub.Service, stub.Method)
+		return nil, nil, fmt.Errorf("Stub for Service:%s and Method:%s is empty", stub.Service, stub.Method)
 	}
 
 	closestMatch := []closeMatch{}
-	for _, stubrange := range stubs {
-		if expect := stubrange.Input.Equals; expect != nil {
-			cm := closeMatch{rule: "equals", expect: expect}
-			if equals(stub.Data, expect) {
-				if headersConstraintsApplied(stubrange.Input, stub, &cm) {
-					return &stubrange.Output, nil
-				}
-			}
-			closestMatch = append(closestMatch, cm)
+	candidates := []candidate{}
+	for i := range stubs {
+		// conversations only answer stream openings, and other stubs only messages
+		if (stubs[i].Conversation != nil) != (stub.Event == EventOpen) {
+			continue
 		}
+		if spec, ok := matchInput(stubs[i].Input, stub, &closestMatch); ok {
+			candidates = append(candidates, candidate{storage: &stubs[i], specificity: spec})
+		}
+	}
 
-		if expect := stubrange.Input.EqualsUnordered; expect != nil {
-			cm := closeMatch{rule: "equals_unordered", expect: expect}
-			if equalsUnordered(stub.Data, expect) {
-				if headersConstraintsApplied(stubrange.Input, stub, &cm) {
-					return &stubrange.Output, nil
-				}
+	if len(candidates) == 0 {
+		return nil, nil, stubNotFoundError(stub, closestMatch)
+	}
+
+	sortCandidates(candidates)
+	for _, c := range candidates {
+		calls := stubCalls[c.storage.ID]
+		if c.storage.expired(calls) || !c.storage.inRequiredState() {
+			continue
+		}
+
+		// a faulted call doesn't count against the stub
+		if output, ok := injectFault(c.storage.Faults); ok {
+			return c.storage, output, nil
+		}
+
+		output, ok := c.storage.nextOutput(calls)
+		if !ok {
+			continue
+		}
+		stubCalls[c.storage.ID]++
+		c.storage.transitionScenario()
+		return c.storage, output, nil
+	}
+
+	return nil, nil, stubNotFoundError(stub, closestMatch)
+}
+
+// candidate is a stored stub whose input rules matched the request
+type candidate struct {
+	storage     *storage
+	specificity specificity
+}
+
+// specificity tells how precisely a stub matched a request.
+// rule is the rank of the matched rule and fields the number of fields it constrains.
+type specificity struct {
+	rule   int
+	fields int
+}
+
+// the stricter the rule, the higher the rank
+var ruleRanks = map[string]int{
+	"equals":           5,
+	"equals_unordered": 4,
+	"contains":         3,
+	"paths":            3,
+	"compare":          2,
+	"expr":             2,
+	"stream":           4,
+	"matches":          1,
+}
+
+// sortCandidates orders matched stubs so that the one to respond comes first:
+// highest priority, then the most specific rule, then the most constrained fields.
+// ties keep insertion order.
+func sortCandidates(candidates []candidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.storage.Priority != b.storage.Priority {
+			return a.storage.Priority > b.storage.Priority
+		}
+		if a.specificity.rule != b.specificity.rule {
+			return a.specificity.rule > b.specificity.rule
+		}
+		return a.specificity.fields > b.specificity.fields
+	})
+}
+
+// matchInput tells whether the request satisfies the input and how specifically.
+// the data rules are OR-ed, then AND-ed with the all_of, any_of and not blocks.
+// rules that didn't match are appended to closestMatch for error reporting.
+func matchInput(input Input, stub *findStubPayload, closestMatch *[]closeMatch) (specificity, bool) {
+	best, matched := matchRules(input, stub, closestMatch)
+	if !matched {
+		return best, false
+	}
+
+	for _, sub := range input.AllOf {
+		spec, ok := matchInput(sub, stub, nil)
+		if !ok {
+			return best, false
+		}
+		best = best.add(spec)
+	}
+
+	if len(input.AnyOf) > 0 {
+		anyMatched := false
+		for _, sub := range input.AnyOf {
+			if spec, ok := matchInput(sub, stub, nil); ok {
+				best, anyMatched = best.add(spec), true
+				break
 			}
-			closestMatch = append(closestMatch, cm)
 		}
+		if !anyMatched {
+			return best, false
+		}
+	}
 
-		if expect := stubrange.Input.Contains; expect != nil {
-			cm := closeMatch{rule: "contains", expect: expect}
-			if contains(expect, stub.Data) {
-				if headersConstraintsApplied(stubrange.Input, stub, &cm) {
-					return &stubrange.Output, nil
-				}
+	if input.Not != nil {
+		if _, ok := matchInput(*input.Not, stub, nil); ok {
+			return best, false
+		}
+		best.fields += countInputFields(*input.Not)
+	}
+
+	return best, true
+}
+
+// matchRules evaluates the data rules of the input against the request and
+// returns the specificity of the most specific rule that matched.
+// an input without data rules only checks the headers.
+func matchRules(input Input, stub *findStubPayload, closestMatch *[]closeMatch) (specificity, bool) {
+	if !input.hasRules() {
+		return specificity{fields: countHeaders(input.Headers)}, headersConstraintsApplied(input, stub, nil)
+	}
+
+	type rule struct {
+		name   string
+		expect map[string]interface{}
+		match  func(expect, actual map[string]interface{}) bool
+	}
+	rules := []rule{
+		{"equals", input.Equals, func(expect, actual map[string]interface{}) bool { return equals(actual, expect) }},
+		{"equals_unordered", input.EqualsUnordered, func(expect, actual map[string]interface{}) bool { return equalsUnordered(actual, expect) }},
+		{"contains", input.Contains, contains},
+		{"paths", input.Paths, matchPaths},
+		{"compare", input.Compare, compare},
+		{"matches", input.Matches, matches},
+	}
+	if input.Expr != "" {
+		rules = append(rules, rule{"expr", map[string]interface{}{"expr": input.Expr}, func(_, actual map[string]interface{}) bool {
+			return evalExpr(input.Expr, &findStubPayload{Data: actual, Headers: stub.Headers})
+		}})
+	}
+	if input.Stream != nil {
+		rules = append(rules, rule{"stream", input.Stream.expect(), func(_, _ map[string]interface{}) bool {
+			return stub.Stream != nil && matchStream(*input.Stream, stub.Stream)
+		}})
+	}
+
+	// a client stream matches the rules on data when every message does
+	matchData := func(r rule) bool {
+		if r.name == "stream" || stub.Stream == nil {
+			return r.match(r.expect, stub.Data)
+		}
+		if len(stub.Stream) == 0 {
+			return false
+		}
+		for _, message := range stub.Stream {
+			if !r.match(r.expect, message) {
+				return false
 			}
-			closestMatch = append(closestMatch, cm)
 		}
+		return true
+	}
 
-		if expect := stubrange.Input.Matches; expect != nil {
-			cm := closeMatch{rule: "matches", expect: expect}
-			if matches(expect, stub.Data) {
-				if headersConstraintsApplied(stubrange.Input, stub, &cm) {
-					return &stubrange.Output, nil
-				}
+	best, matched := specificity{}, false
+	for _, rule := range rules {
+		if rule.expect == nil {
+			continue
+		}
+
+		cm := closeMatch{rule: rule.name, expect: rule.expect}
+		if matchData(rule) && headersConstraintsApplied(input, stub, &cm) {
+			spec := specificity{
+				rule:   ruleRanks[rule.name],
+				fields: countFields(rule.expect) + countHeaders(input.Headers),
+			}
+			if !matched || spec.rule > best.rule || (spec.rule == best.rule && spec.fields > best.fields) {
+				best, matched = spec, true
 			}
-			closestMatch = append(closestMatch, cm)
+			continue
+		}
+		if closestMatch != nil {
+			*closestMatch = append(*closestMatch, cm)
+		}
+	}
+
+	return best, matched
+}
+
+// add combines the specificity of rules that must all match
+func (s specificity) add(other specificity) specificity {
+	if other.rule > s.rule {
+		s.rule = other.rule
+	}
+	s.fields += other.fields
+	return s
+}
+
+// countInputFields counts every field constrained by the input and its nested blocks
+func countInputFields(input Input) int {
+	count := countHeaders(input.Headers)
+	if input.Expr != "" {
+		count++
+	}
+	if input.Stream != nil {
+		count += countFields(input.Stream.expect())
+	}
+	for _, expect := range []map[string]interface{}{input.Equals, input.EqualsUnordered, input.Contains, input.Paths, input.Compare, input.Matches} {
+		if expect != nil {
+			count += countFields(expect)
+		}
+	}
+	for _, sub := range input.AllOf {
+		count += countInputFields(sub)
+	}
+	for _, sub := range input.AnyOf {
+		count += countInputFields(sub)
+	}
+	if input.Not != nil {
+		count += countInputFields(*input.Not)
+	}
+	return count
+}
+
+// countFields counts the leaf values of an expectation
+func countFields(expect interface{}) int {
+	switch v := expect.(type) {
+	case map[string]interface{}:
+		count := 0
+		for _, item := range v {
+			count += countFields(item)
+		}
+		return count
+	case []interface{}:
+		count := 0
+		for _, item := range v {
+			count += countFields(item)
 		}
+		return count
+	default:
+		return 1
 	}
+}
 
-	return nil, stubNotFoundError(stub, closestMatch)
+func countHeaders(headers *InputHeaders) int {
+	if headers == nil {
+		return 0
+	}
+	return len(headers.Equals) + len(headers.EqualsUnordered) + len(headers.Contains) + len(headers.Matches)
 }
 
 func copyHeaders(headers map[string]string) map[string]interface{} {
@@ -243,6 +658,9 @@ func headersConstraintsApplied(expectedInput Input, stub *findStubPayload, close
 func stubNotFoundError(stub *findStubPayload, closestMatches []closeMatch) error {
 	template := fmt.Sprintf("Can't find stub \n\nService: %s \n\nMethod: %s \n\nInput\n\n", stub.Service, stub.Method)
 	expectString := "Data:\n" + renderFieldAsString(stub.Data)
+	if stub.Stream != nil {
+		expectString = "Stream:\n" + renderFieldAsString(map[string]interface{}{"messages": messageList(stub.Stream)})
+	}
 	template += expectString
 	if stub.Headers != nil {
 		headers := copyHeaders(stub.Headers)
@@ -461,10 +879,13 @@ func clearStorage() {
 	defer mx.Unlock()
 
 	stubStorage = stubMapping{}
-	requestStorage = []*request{}
+	requestStorage.clear()
+	stubCalls = map[string]int{}
+	scenarioStates = map[string]string{}
 }
 
 func readStubFromFile(path string) int {
+	clearLoadErrors("")
 	return stubStorage.readStubFromFile(path)
 }
 
@@ -482,49 +903,124 @@ func (sm *stubMapping) readStubFromFile(path string) int {
 			continue
 		}
 
-		// Only process .json files
-		if !strings.HasSuffix(strings.ToLower(file.Name()), ".json") {
+		// Only process .json, .yaml and .yml files
+		if !isStubFile(file.Name()) {
 			continue
 		}
+		_, stored := sm.readStubFile(path + "/" + file.Name())
+		count += stored
+	}
 
-		filePath := path + "/" + file.Name()
-		byt, err := os.ReadFile(filePath)
-		if err != nil {
-			log.Printf("Error when reading file %s. %v. skipping...", file.Name(), err)
-			continue
-		}
+	return count
+}
 
-		// Try to unmarshal as array first
-		var stubs []*Stub
-		err = json.Unmarshal(byt, &stubs)
-		if err == nil && len(stubs) > 0 {
-			// Successfully unmarshaled as array
-			log.Printf("Successfully unmarshaled %s as array with %d stubs", file.Name(), len(stubs))
-			for _, s := range stubs {
-				if err = sm.storeStub(s); err != nil {
-					log.Printf("Error when storing Stub from %s. %v. skipping...", file.Name(), err)
-				} else {
-					count++
-				}
-			}
-			continue
+// isStubFile tells whether a file is read for stubs
+func isStubFile(name string) bool {
+	return isYAMLFile(name) || strings.HasSuffix(strings.ToLower(name), ".json")
+}
+
+// readStubFile replaces the stubs of a file by the ones it holds now, and returns how many
+// were removed and stored. the stubs keep the file as their source, and their errors are
+// recorded in loadErrors. the file is read and validated first, so the stubs are swapped at once.
+func (sm *stubMapping) readStubFile(filePath string) (removed, stored int) {
+	// the same file always has the same source, however its folder was given
+	filePath = filepath.Clean(filePath)
+
+	var loadErrs []*loadError
+	stubs, lines, err := parseStubFile(filePath)
+	if err != nil {
+		loadErr, ok := err.(*loadError)
+		if !ok {
+			loadErr = &loadError{File: filePath, Reason: err.Error()}
 		}
+		loadErrs = append(loadErrs, loadErr)
+	}
 
-		// If array unmarshal failed, try as single stub
-		var stub Stub
-		err = json.Unmarshal(byt, &stub)
-		if err != nil {
-			log.Printf("Error when unmarshalling file %s. %v. skipping...", file.Name(), err)
+	errs := make([]error, len(stubs))
+	for i, s := range stubs {
+		s.source = filePath
+		// validated on a copy, file stubs keep their method as written
+		valid := *s
+		errs[i] = validateStub(&valid)
+	}
+
+	mx.Lock()
+	removed = sm.removeSource(filePath)
+	for i, s := range stubs {
+		if errs[i] == nil {
+			errs[i] = sm.store(s)
+		}
+		if errs[i] == nil {
+			stored++
 			continue
 		}
-
-		if err = sm.storeStub(&stub); err != nil {
-			log.Printf("Error when storing Stub from %s. %v. skipping...", file.Name(), err)
-		} else {
-			count++
+		index := i
+		loadErr := &loadError{File: filePath, Index: &index, Reason: errs[i].Error()}
+		if lines != nil {
+			loadErr.Line = lines[i]
 		}
+		loadErrs = append(loadErrs, loadErr)
+	}
+	delete(loadErrors, filePath)
+	if len(loadErrs) > 0 {
+		loadErrors[filePath] = loadErrs
+	}
+	mx.Unlock()
+
+	for _, loadErr := range loadErrs {
+		log.Printf("Error when loading %v. skipping...", loadErr)
+	}
+	return removed, stored
+}
+
+// parseStubFile reads the stubs of a json or yaml file. the lines of the stubs are only known for yaml.
+func parseStubFile(filePath string) ([]*Stub, []int, error) {
+	byt, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if isYAMLFile(filePath) {
+		return parseYAMLStubs(filePath, byt)
 	}
 
+	// Try to unmarshal as array first
+	var stubs []*Stub
+	err = json.Unmarshal(byt, &stubs)
+	if err == nil && len(stubs) > 0 {
+		// Successfully unmarshaled as array
+		log.Printf("Successfully unmarshaled %s as array with %d stubs", filePath, len(stubs))
+		return stubs, nil, nil
+	}
+	if err != nil && strings.HasPrefix(strings.TrimSpace(string(byt)), "[") {
+		return nil, nil, &loadError{File: filePath, Line: jsonErrorLine(byt, err), Reason: err.Error()}
+	}
+
+	// If array unmarshal failed, try as single stub
+	var stub Stub
+	err = json.Unmarshal(byt, &stub)
+	if err != nil {
+		return nil, nil, &loadError{File: filePath, Line: jsonErrorLine(byt, err), Reason: err.Error()}
+	}
+	return []*Stub{&stub}, nil, nil
+}
+
+// removeSource drops the stubs loaded from a file, and returns how many were dropped.
+// caller must hold mx.
+func (sm *stubMapping) removeSource(filePath string) int {
+	count := 0
+	for service, methods := range *sm {
+		for method, stubs := range methods {
+			for i := len(stubs) - 1; i >= 0; i-- {
+				if stubs[i].Source != filePath {
+					continue
+				}
+				delete(stubCalls, stubs[i].ID)
+				sm.remove(service, method, i)
+				count++
+			}
+		}
+	}
 	return count
 }
 
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
 )
 
 func Test_findStub(t *testing.T) {
@@ -533,7 +534,321 @@ func Test_readStubFromFile(t *testing.T) {
 			sm := stubMapping{}
 			count := sm.readStubFromFile(tt.mock(tt.service, tt.method, tt.data))
 			require.Equal(t, tt.expectCount, count)
-			require.ElementsMatch(t, tt.data, sm[tt.service][tt.method])
+
+			// ids are generated on load, and stubs remember their file
+			stored := sm[tt.service][tt.method]
+			for i := range stored {
+				require.NotEmpty(t, stored[i].ID)
+				require.NotEmpty(t, stored[i].Source)
+				stored[i].ID = ""
+				stored[i].Source = ""
+			}
+			require.ElementsMatch(t, tt.data, stored)
+		})
+	}
+}
+
+func Test_updateStub(t *testing.T) {
+	clearStorage()
+	stub := &Stub{
+		Service: "user",
+		Method:  "GetUser",
+		Input:   Input{Equals: map[string]interface{}{"id": 1}},
+		Output:  Output{Data: map[string]interface{}{"name": "John"}},
+	}
+	require.NoError(t, storeStub(stub))
+	require.NotEmpty(t, stub.ID)
+
+	moved := &Stub{
+		Service: "user",
+		Method:  "FindUser",
+		Input:   Input{Equals: map[string]interface{}{"id": 1}},
+		Output:  Output{Data: map[string]interface{}{"name": "Jane"}},
+	}
+	require.True(t, updateStub(stub.ID, moved))
+	require.Equal(t, stub.ID, moved.ID)
+	require.NotContains(t, allStub()["user"], "GetUser")
+
+	got, ok := getStub(stub.ID)
+	require.True(t, ok)
+	require.Equal(t, moved, got)
+
+	require.False(t, updateStub("unknown", moved))
+}
+
+func Test_findStubSelection(t *testing.T) {
+	tests := []struct {
+		name       string
+		setup      []*Stub
+		input      *findStubPayload
+		wantOutput map[string]interface{}
+	}{
+		{
+			name: "equals beats earlier contains",
+			setup: []*Stub{
+				{
+					Input:  Input{Contains: map[string]interface{}{"id": 1}},
+					Output: Output{Data: map[string]interface{}{"name": "default"}},
+				},
+				{
+					Input:  Input{Equals: map[string]interface{}{"id": 1, "details": true}},
+					Output: Output{Data: map[string]interface{}{"name": "precise"}},
+				},
+			},
+			input: &findStubPayload{
+				Data: map[string]interface{}{"id": 1, "details": true},
+			},
+			wantOutput: map[string]interface{}{"name": "precise"},
+		},
+		{
+			name: "more fields beats fewer",
+			setup: []*Stub{
+				{
+					Input:  Input{Contains: map[string]interface{}{"id": 1}},
+					Output: Output{Data: map[string]interface{}{"name": "broad"}},
+				},
+				{
+					Input:  Input{Contains: map[string]interface{}{"id": 1, "details": true}},
+					Output: Output{Data: map[string]interface{}{"name": "narrow"}},
+				},
+			},
+			input: &findStubPayload{
+				Data: map[string]interface{}{"id": 1, "details": true, "extra": "x"},
+			},
+			wantOutput: map[string]interface{}{"name": "narrow"},
+		},
+		{
+			name: "priority beats specificity",
+			setup: []*Stub{
+				{
+					Input:  Input{Equals: map[string]interface{}{"id": "1"}},
+					Output: Output{Data: map[string]interface{}{"name": "precise"}},
+				},
+				{
+					Priority: 10,
+					Input:    Input{Matches: map[string]interface{}{"id": ".*"}},
+					Output:   Output{Data: map[string]interface{}{"name": "override"}},
+				},
+			},
+			input: &findStubPayload{
+				Data: map[string]interface{}{"id": "1"},
+			},
+			wantOutput: map[string]interface{}{"name": "override"},
+		},
+		{
+			name: "tie keeps insertion order",
+			setup: []*Stub{
+				{
+					Input:  Input{Contains: map[string]interface{}{"id": 1}},
+					Output: Output{Data: map[string]interface{}{"name": "first"}},
+				},
+				{
+					Input:  Input{Contains: map[string]interface{}{"id": 1}},
+					Output: Output{Data: map[string]interface{}{"name": "second"}},
+				},
+			},
+			input: &findStubPayload{
+				Data: map[string]interface{}{"id": 1},
+			},
+			wantOutput: map[string]interface{}{"name": "first"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearStorage()
+			for _, s := range tt.setup {
+				s.Service, s.Method = "user", "GetUser"
+				require.NoError(t, storeStub(s))
+			}
+			tt.input.Service, tt.input.Method = "user", "GetUser"
+
+			got, err := findStub(tt.input)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantOutput, got.Data)
 		})
 	}
 }
+
+func Test_findStubSequence(t *testing.T) {
+	outputs := []Output{
+		{Data: map[string]interface{}{"status": "PENDING"}},
+		{Data: map[string]interface{}{"status": "PENDING"}},
+		{Data: map[string]interface{}{"status": "DONE"}},
+	}
+
+	tests := []struct {
+		name        string
+		onExhausted string
+		want        []string
+	}{
+		{
+			name: "repeat last output by default",
+			want: []string{"PENDING", "PENDING", "DONE", "DONE", "DONE"},
+		},
+		{
+			name:        "cycle",
+			onExhausted: OnExhaustedCycle,
+			want:        []string{"PENDING", "PENDING", "DONE", "PENDING", "PENDING"},
+		},
+		{
+			name:        "fall through to next matching stub",
+			onExhausted: OnExhaustedFallthrough,
+			want:        []string{"PENDING", "PENDING", "DONE", "FALLBACK", "FALLBACK"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearStorage()
+			require.NoError(t, storeStub(&Stub{
+				Service:     "job",
+				Method:      "GetStatus",
+				Input:       Input{Equals: map[string]interface{}{"id": "1"}},
+				Outputs:     outputs,
+				OnExhausted: tt.onExhausted,
+			}))
+			require.NoError(t, storeStub(&Stub{
+				Service: "job",
+				Method:  "GetStatus",
+				Input:   Input{Contains: map[string]interface{}{"id": "1"}},
+				Output:  Output{Data: map[string]interface{}{"status": "FALLBACK"}},
+			}))
+
+			for i, want := range tt.want {
+				got, err := findStub(&findStubPayload{
+					Service: "job",
+					Method:  "GetStatus",
+					Data:    map[string]interface{}{"id": "1"},
+				})
+				require.NoError(t, err)
+				require.Equal(t, want, got.Data["status"], "call %d", i)
+			}
+		})
+	}
+}
+
+func Test_findStubTimes(t *testing.T) {
+	clearStorage()
+	unavailable := codes.Unavailable
+	require.NoError(t, storeStub(&Stub{
+		Service: "payment",
+		Method:  "Charge",
+		Times:   2,
+		Input:   Input{Contains: map[string]interface{}{"amount": float64(100)}},
+		Output:  Output{Error: "try again", Code: &unavailable},
+	}))
+
+	payload := &findStubPayload{
+		Service: "payment",
+		Method:  "Charge",
+		Data:    map[string]interface{}{"amount": float64(100)},
+	}
+
+	for i := 0; i < 2; i++ {
+		got, err := findStub(payload)
+		require.NoError(t, err)
+		require.Equal(t, &unavailable, got.Code)
+	}
+
+	// expired stub behaves as if it weren't there
+	_, err := findStub(payload)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "Can't find stub")
+
+	require.NoError(t, storeStub(&Stub{
+		Service: "payment",
+		Method:  "Charge",
+		Input:   Input{Contains: map[string]interface{}{"amount": float64(100)}},
+		Output:  Output{Data: map[string]interface{}{"status": "OK"}},
+	}))
+	got, err := findStub(payload)
+	require.NoError(t, err)
+	require.Equal(t, "OK", got.Data["status"])
+}
+
+func Test_matchInputCombinators(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		data  string
+		want  bool
+	}{
+		{
+			name:  "contains and not matches",
+			input: `{"contains":{"user_id":42},"not":{"matches":{"email":".*@test\\.com"}}}`,
+			data:  `{"user_id":42,"email":"jane@example.com"}`,
+			want:  true,
+		},
+		{
+			name:  "not excludes",
+			input: `{"contains":{"user_id":42},"not":{"matches":{"email":".*@test\\.com"}}}`,
+			data:  `{"user_id":42,"email":"jane@test.com"}`,
+			want:  false,
+		},
+		{
+			name:  "all_of only",
+			input: `{"all_of":[{"contains":{"a":1}},{"compare":{"b":{"gt":1}}}]}`,
+			data:  `{"a":1,"b":2}`,
+			want:  true,
+		},
+		{
+			name:  "all_of fails on one",
+			input: `{"all_of":[{"contains":{"a":1}},{"compare":{"b":{"gt":1}}}]}`,
+			data:  `{"a":1,"b":1}`,
+			want:  false,
+		},
+		{
+			name:  "any_of",
+			input: `{"any_of":[{"equals":{"a":1}},{"equals":{"a":2}}]}`,
+			data:  `{"a":2}`,
+			want:  true,
+		},
+		{
+			name:  "any_of none",
+			input: `{"any_of":[{"equals":{"a":1}},{"equals":{"a":2}}]}`,
+			data:  `{"a":3}`,
+			want:  false,
+		},
+		{
+			name:  "nested combinators",
+			input: `{"contains":{"a":1},"any_of":[{"not":{"contains":{"b":1}}},{"contains":{"c":1}}]}`,
+			data:  `{"a":1,"b":1,"c":1}`,
+			want:  true,
+		},
+		{
+			name:  "not on headers",
+			input: `{"contains":{"a":1},"not":{"headers":{"equals":{"x-env":"test"}}}}`,
+			data:  `{"a":1}`,
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := Input{}
+			require.NoError(t, json.Unmarshal([]byte(tt.input), &input))
+			payload := &findStubPayload{Headers: map[string]string{"x-env": "test"}}
+			require.NoError(t, json.Unmarshal([]byte(tt.data), &payload.Data))
+
+			_, got := matchInput(input, payload, nil)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_validateStubCombinators(t *testing.T) {
+	stub := &Stub{
+		Service: "user",
+		Method:  "GetUser",
+		Input:   Input{Not: &Input{Contains: map[string]interface{}{"id": 1}}},
+		Output:  Output{Data: map[string]interface{}{"name": "John"}},
+	}
+	require.NoError(t, validateStub(stub))
+
+	stub.Input = Input{AllOf: []Input{{Contains: map[string]interface{}{"id": 1}}, {}}}
+	require.EqualError(t, validateStub(stub), "all_of[1]: input can't be empty")
+
+	stub.Input = Input{AnyOf: []Input{{Compare: map[string]interface{}{"id": "one"}}}}
+	require.EqualError(t, validateStub(stub), "any_of[0]: invalid compare rule: id: one is not a number")
+}
@@ -0,0 +1,97 @@
+package stub
+
+import (
+	"fmt"
+)
+
+// StreamInput holds the rules of a client stream, matched against the
+// whole stream of request messages. all the rules it holds must pass.
+type StreamInput struct {
+	// Equals is the exact sequence of messages
+	Equals []map[string]interface{} `json:"equals,omitempty"`
+	// Contains are messages that must each be contained by some message of the stream
+	Contains []map[string]interface{} `json:"contains,omitempty"`
+	// Count is the number of messages, or a condition on it such as {"gte": 2}
+	Count interface{} `json:"count,omitempty"`
+}
+
+func (s StreamInput) isEmpty() bool {
+	return s.Equals == nil && s.Contains == nil && s.Count == nil
+}
+
+// expect describes the rules for counting fields and reporting close matches
+func (s StreamInput) expect() map[string]interface{} {
+	expect := map[string]interface{}{}
+	if s.Equals != nil {
+		expect["equals"] = messageList(s.Equals)
+	}
+	if s.Contains != nil {
+		expect["contains"] = messageList(s.Contains)
+	}
+	if s.Count != nil {
+		expect["count"] = s.Count
+	}
+	return expect
+}
+
+func validateStreamInput(s StreamInput) error {
+	if s.isEmpty() {
+		return fmt.Errorf("stream rule can't be empty")
+	}
+	if s.Count != nil {
+		count, err := parseComparisons(s.Count)
+		if err != nil {
+			return fmt.Errorf("invalid stream count: %v", err)
+		}
+		if _, ok := count.(comparison); !ok {
+			return fmt.Errorf("stream count must be a number or a comparison")
+		}
+	}
+	return nil
+}
+
+// matchStream tells whether the messages of a client stream satisfy the rules
+func matchStream(s StreamInput, stream []map[string]interface{}) bool {
+	if s.Equals != nil {
+		if len(s.Equals) != len(stream) {
+			return false
+		}
+		for i, expect := range s.Equals {
+			if !equals(stream[i], expect) {
+				return false
+			}
+		}
+	}
+
+	for _, expect := range s.Contains {
+		found := false
+		for _, message := range stream {
+			if contains(expect, message) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if s.Count != nil {
+		count, err := parseComparisons(s.Count)
+		if err != nil {
+			return false
+		}
+		if !compareMatch(count, float64(len(stream))) {
+			return false
+		}
+	}
+	return true
+}
+
+func messageList(messages []map[string]interface{}) []interface{} {
+	list := make([]interface{}, len(messages))
+	for i, message := range messages {
+		list[i] = message
+	}
+	return list
+}
@@ -0,0 +1,223 @@
+package stub
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func Test_findStubStream(t *testing.T) {
+	clearStorage()
+	unavailable := codes.Unavailable
+	require.NoError(t, storeStub(&Stub{
+		Service: "Prices",
+		Method:  "Watch",
+		Input:   Input{Contains: map[string]interface{}{"symbol": "ACME"}},
+		Output: Output{
+			Stream: []map[string]interface{}{
+				{"symbol": "{{ .Request.symbol }}", "price": 1},
+				{"symbol": "{{ .Request.symbol }}", "price": 2},
+				{"symbol": "{{ .Request.symbol }}", "price": 3},
+			},
+			StreamDelay: &Delay{Min: Duration(10 * time.Millisecond), Max: Duration(20 * time.Millisecond)},
+			Error:       "feed closed",
+			Code:        &unavailable,
+		},
+	}))
+
+	body := []byte(`{"service":"Prices","method":"Watch","data":{"symbol":"ACME"}}`)
+	res := httptest.NewRecorder()
+	handleFindStub(res, httptest.NewRequest(http.MethodPost, "/find", bytes.NewReader(body)))
+	require.Equal(t, http.StatusOK, res.Code)
+
+	got := struct {
+		Stream       []map[string]interface{} `json:"stream"`
+		StreamDelays []*Delay                 `json:"stream_delays"`
+		Error        string                   `json:"error"`
+		Code         codes.Code               `json:"code"`
+	}{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+	require.Len(t, got.Stream, 3)
+	for i, message := range got.Stream {
+		assert.Equal(t, "ACME", message["symbol"])
+		assert.Equal(t, float64(i+1), message["price"])
+	}
+	require.Len(t, got.StreamDelays, 2)
+	for _, delay := range got.StreamDelays {
+		assert.GreaterOrEqual(t, time.Duration(delay.Fixed), 10*time.Millisecond)
+		assert.LessOrEqual(t, time.Duration(delay.Fixed), 20*time.Millisecond)
+	}
+	assert.Equal(t, "feed closed", got.Error)
+	assert.Equal(t, codes.Unavailable, got.Code)
+
+	requests := allRequests(requestFilter{})
+	require.Len(t, requests, 1)
+	assert.Equal(t, OutcomeError, requests[0].Outcome)
+	assert.Len(t, requests[0].ResponseStream, 3)
+}
+
+func Test_validateStubStream(t *testing.T) {
+	err := validateStub(&Stub{
+		Service: "Prices",
+		Method:  "Watch",
+		Input:   Input{Contains: map[string]interface{}{"symbol": "ACME"}},
+		Output:  Output{Stream: []map[string]interface{}{{"price": 1}}},
+	})
+	assert.NoError(t, err)
+
+	err = validateStub(&Stub{
+		Service: "Prices",
+		Method:  "Watch",
+		Input:   Input{Contains: map[string]interface{}{"symbol": "ACME"}},
+		Output: Output{
+			Stream:      []map[string]interface{}{{"price": 1}},
+			StreamDelay: &Delay{Min: Duration(time.Second), Max: Duration(time.Millisecond)},
+		},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stream_delay")
+}
+
+func Test_matchStream(t *testing.T) {
+	stream := []map[string]interface{}{
+		{"id": "1", "qty": float64(2)},
+		{"id": "2", "qty": float64(1)},
+		{"id": "3", "qty": float64(5)},
+	}
+	tests := []struct {
+		name  string
+		input StreamInput
+		want  bool
+	}{
+		{
+			name: "exact sequence",
+			input: StreamInput{Equals: []map[string]interface{}{
+				{"id": "1", "qty": float64(2)}, {"id": "2", "qty": float64(1)}, {"id": "3", "qty": float64(5)},
+			}},
+			want: true,
+		},
+		{
+			name: "sequence out of order",
+			input: StreamInput{Equals: []map[string]interface{}{
+				{"id": "2", "qty": float64(1)}, {"id": "1", "qty": float64(2)}, {"id": "3", "qty": float64(5)},
+			}},
+			want: false,
+		},
+		{
+			name:  "sequence too short",
+			input: StreamInput{Equals: []map[string]interface{}{{"id": "1", "qty": float64(2)}}},
+			want:  false,
+		},
+		{
+			name:  "contains elements",
+			input: StreamInput{Contains: []map[string]interface{}{{"id": "3"}, {"qty": float64(1)}}},
+			want:  true,
+		},
+		{
+			name:  "contains missing element",
+			input: StreamInput{Contains: []map[string]interface{}{{"id": "4"}}},
+			want:  false,
+		},
+		{name: "count", input: StreamInput{Count: float64(3)}, want: true},
+		{name: "count mismatch", input: StreamInput{Count: float64(2)}, want: false},
+		{name: "count comparison", input: StreamInput{Count: map[string]interface{}{"gte": 2}}, want: true},
+		{
+			name:  "all rules must pass",
+			input: StreamInput{Contains: []map[string]interface{}{{"id": "3"}}, Count: map[string]interface{}{"lt": 3}},
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchStream(tt.input, stream))
+		})
+	}
+}
+
+func Test_findStubClientStream(t *testing.T) {
+	clearStorage()
+	require.NoError(t, storeStub(&Stub{
+		Service: "Orders",
+		Method:  "Upload",
+		Input: Input{AllOf: []Input{
+			{Contains: map[string]interface{}{"tenant": "acme"}},
+			{Stream: &StreamInput{Count: map[string]interface{}{"gte": 2}}},
+		}},
+		Output: Output{Data: map[string]interface{}{"total": "{{ len .Stream }}"}},
+	}))
+	require.NoError(t, storeStub(&Stub{
+		Service: "Orders",
+		Method:  "Upload",
+		Input:   Input{Stream: &StreamInput{Count: float64(1)}},
+		Output:  Output{Data: map[string]interface{}{"total": "one"}},
+	}))
+	require.NoError(t, storeStub(&Stub{
+		Service: "Orders",
+		Method:  "Upload",
+		Input:   Input{Stream: &StreamInput{Count: map[string]interface{}{"lte": 0}}},
+		Output:  Output{Data: map[string]interface{}{"total": "none"}},
+	}))
+
+	tests := []struct {
+		name    string
+		stream  []map[string]interface{}
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "every message matches",
+			stream: []map[string]interface{}{{"tenant": "acme", "id": "1"}, {"tenant": "acme", "id": "2"}},
+			want:   "2",
+		},
+		{
+			name:    "one message doesn't match",
+			stream:  []map[string]interface{}{{"tenant": "acme", "id": "1"}, {"tenant": "other", "id": "2"}},
+			wantErr: true,
+		},
+		{
+			name:   "count",
+			stream: []map[string]interface{}{{"tenant": "other"}},
+			want:   "one",
+		},
+		{
+			name:   "empty stream",
+			stream: []map[string]interface{}{},
+			want:   "none",
+		},
+		{
+			name:    "not a stream",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findStub(&findStubPayload{Service: "Orders", Method: "Upload", Stream: tt.stream})
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got.Data["total"])
+		})
+	}
+
+	requests := allRequests(requestFilter{})
+	require.Len(t, requests, 5)
+	assert.Equal(t, tests[0].stream, requests[0].Stream)
+}
+
+func Test_validateStreamInput(t *testing.T) {
+	assert.Error(t, validateStreamInput(StreamInput{}))
+	assert.Error(t, validateStreamInput(StreamInput{Count: "many"}))
+	assert.Error(t, validateStreamInput(StreamInput{Count: map[string]interface{}{"id": 1}}))
+	assert.NoError(t, validateStreamInput(StreamInput{Count: map[string]interface{}{"between": []interface{}{1, 3}}}))
+}
@@ -6,6 +6,9 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"regexp"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi"
 	"golang.org/x/text/cases"
@@ -17,9 +20,27 @@ type Options struct {
 	Port     string
 	BindAddr string
 	StubPath string
+
+	// retention of the request journal. zero means unbounded
+	JournalMaxEntries int
+	JournalMaxAge     time.Duration
+
+	// Seed of faults, delays and random template values. zero means random
+	Seed int64
+
+	// Watch reloads the stubs of the files changed under StubPath
+	Watch bool
+
+	// StrictStubs aborts startup when a stub file or stub can't be loaded
+	StrictStubs bool
+
+	// DescriptorSet is the file of the FileDescriptorSet of the mocked services,
+	// which the stubs are validated against. empty skips the validation.
+	DescriptorSet string
 }
 
 const DEFAULT_PORT = "4771"
+const DEFAULT_JOURNAL_MAX_ENTRIES = 10000
 
 var stubPath string
 
@@ -28,18 +49,59 @@ func RunStubServer(opt Options) {
 		opt.Port = DEFAULT_PORT
 	}
 	stubPath = opt.StubPath
+	configureJournal(opt.JournalMaxEntries, opt.JournalMaxAge)
+	if opt.Seed != 0 {
+		seedRandom(opt.Seed)
+	}
 	addr := opt.BindAddr + ":" + opt.Port
 	r := chi.NewRouter()
 	r.Post("/add", addStub)
 	r.Get("/", listStub)
+	r.Get("/stubs/{id}", handleGetStub)
+	r.Put("/stubs/{id}", handleUpdateStub)
+	r.Delete("/stubs/{id}", handleDeleteStub)
 	r.Post("/find", handleFindStub)
+	r.Post("/render", handleRender)
 	r.Get("/clear", handleClearStub)
 	r.Post("/reset", handleResetStub)
+	r.Get("/load-errors", handleLoadErrors)
 	r.Get("/requests", listRequests)
+	r.Delete("/requests", handleClearRequests)
+	r.Post("/requests/{id}/end", handleEndRequest)
+	r.Post("/verify", handleVerify)
+	r.Get("/scenarios", listScenarios)
+	r.Put("/scenarios/{name}/state", handleSetScenarioState)
+	r.Post("/scenarios/reset", handleResetScenarios)
+	r.Get("/chaos", handleGetChaos)
+	r.Put("/chaos", handleSetChaos)
+	r.Delete("/chaos", handleClearChaos)
+
+	if opt.DescriptorSet != "" {
+		if err := loadDescriptors(opt.DescriptorSet); err != nil {
+			log.Printf("Can't load proto descriptors, stubs won't be validated against them. %v\n", err)
+		}
+	}
 
 	if opt.StubPath != "" {
+		// files changed while they're loaded are reloaded by the first scan
+		var files map[string]fileState
+		if opt.Watch {
+			files = scanStubFiles(opt.StubPath)
+		}
 		count := readStubFromFile(opt.StubPath)
 		fmt.Printf("Loaded %d stubs from %s\n", count, opt.StubPath)
+		if errs := allLoadErrors(); len(errs) > 0 {
+			fmt.Printf("Failed to load %d stubs or files, see GET /load-errors\n", len(errs))
+			if opt.StrictStubs {
+				log.Fatalf("Aborting on invalid stubs (--strict-stubs): %v", errs[0])
+			}
+		}
+		if opt.Watch {
+			fmt.Printf("Watching stub files under %s\n", opt.StubPath)
+			go watchStubs(opt.StubPath, files)
+		}
+	} else if opt.Watch {
+		log.Println("--watch has no effect without --stub")
 	}
 
 	fmt.Println("Serving stub admin on http://" + addr)
@@ -57,19 +119,70 @@ func responseError(err error, w http.ResponseWriter) {
 }
 
 type Stub struct {
-	Service string `json:"service"`
-	Method  string `json:"method"`
-	Input   Input  `json:"input"`
-	Output  Output `json:"output"`
+	ID       string `json:"id,omitempty"`
+	Service  string `json:"service"`
+	Method   string `json:"method"`
+	Priority int    `json:"priority,omitempty"`
+	Times    int    `json:"times,omitempty"` // how many times the stub may match. 0 means unlimited
+	Input    Input  `json:"input"`
+	Output   Output `json:"output"`
+
+	// Outputs are returned one per matching call, in order.
+	// when set, it takes precedence over Output.
+	Outputs     []Output `json:"outputs,omitempty"`
+	OnExhausted string   `json:"on_exhausted,omitempty"`
+
+	// the stub is only considered while Scenario is in RequiredState,
+	// and moves the scenario to NewState when it responds
+	Scenario      string `json:"scenario,omitempty"`
+	RequiredState string `json:"required_state,omitempty"`
+	NewState      string `json:"new_state,omitempty"`
+
+	// Faults make a share of the matching calls fail instead
+	Faults []Fault `json:"faults,omitempty"`
+
+	// Conversation makes the stub answer the opening of a bidirectional stream
+	Conversation *Conversation `json:"conversation,omitempty"`
+
+	// the file the stub was loaded from
+	source string
 }
 
+// behaviors of a stub once all of its Outputs have been returned
+const (
+	OnExhaustedRepeat      = "repeat"
+	OnExhaustedCycle       = "cycle"
+	OnExhaustedFallthrough = "fallthrough"
+)
+
 type Input struct {
 	Equals          map[string]interface{} `json:"equals"`
 	EqualsUnordered map[string]interface{} `json:"equals_unordered"`
 	Contains        map[string]interface{} `json:"contains"`
 	Matches         map[string]interface{} `json:"matches"`
+	Compare         map[string]interface{} `json:"compare,omitempty"`
+	Paths           map[string]interface{} `json:"paths,omitempty"`
+	Expr            string                 `json:"expr,omitempty"`
+
+	// Stream rules match the whole stream of a client streaming call.
+	// the rules above must then match every message of the stream.
+	Stream *StreamInput `json:"stream,omitempty"`
 
 	Headers *InputHeaders `json:"headers,omitempty"`
+
+	// nested rule blocks AND-ed with the rules above
+	AllOf []Input `json:"all_of,omitempty"`
+	AnyOf []Input `json:"any_of,omitempty"`
+	Not   *Input  `json:"not,omitempty"`
+}
+
+// hasRules tells whether the input has any rule on the request data
+func (i Input) hasRules() bool {
+	return i.Equals != nil || i.EqualsUnordered != nil || i.Contains != nil || i.Matches != nil || i.Compare != nil || i.Paths != nil || i.Expr != "" || i.Stream != nil
+}
+
+func (i Input) hasCombinators() bool {
+	return len(i.AllOf) > 0 || len(i.AnyOf) > 0 || i.Not != nil
 }
 
 type InputHeaders struct {
@@ -84,6 +197,30 @@ type Output struct {
 	Error   string                 `json:"error"`
 	Code    *codes.Code            `json:"code,omitempty"`
 	Headers map[string]string      `json:"headers,omitempty"`
+	Delay   *Delay                 `json:"delay,omitempty"`
+
+	// Trailers are sent when the call ends, with the response or the error
+	Trailers map[string]string `json:"trailers,omitempty"`
+
+	// Stream is the ordered messages of a server streaming response, sent
+	// StreamDelay apart. Error and Code, when set, end the stream after the last message.
+	Stream      []map[string]interface{} `json:"stream,omitempty"`
+	StreamDelay *Delay                   `json:"stream_delay,omitempty"`
+	// Periodic keeps the stream sending messages on an interval instead
+	Periodic *Periodic `json:"periodic,omitempty"`
+
+	// Details are google.rpc.Status details of the error, each one a
+	// message in the JSON form of Any, e.g. {"@type":"google.rpc.ErrorInfo", ...}
+	Details []map[string]interface{} `json:"details,omitempty"`
+
+	// fault tells the output was injected rather than stubbed
+	fault bool
+	// streamDelays are sampled from StreamDelay, one before each message but the first
+	streamDelays []*Delay
+	// conversation is the rendered conversation of the stub answering a stream opening
+	conversation *Conversation
+	// requestID is the journal entry of the call, which the generated server ends
+	requestID int
 }
 
 func addStub(w http.ResponseWriter, r *http.Request) {
@@ -112,7 +249,71 @@ func addStub(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if _, err = w.Write([]byte("Success add stub")); err != nil {
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(addStubResponse{ID: stub.ID}); err != nil {
+		log.Println("Error writing response: %w", err)
+	}
+}
+
+type addStubResponse struct {
+	ID string `json:"id"`
+}
+
+func handleGetStub(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	stub, ok := getStub(id)
+	if !ok {
+		responseNotFound(id, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stub); err != nil {
+		log.Println("Error writing handleGetStub response: %w", err)
+	}
+}
+
+func handleUpdateStub(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	stub := new(Stub)
+	err := json.NewDecoder(r.Body).Decode(stub)
+	if err != nil {
+		responseError(err, w)
+		return
+	}
+
+	err = validateStub(stub)
+	if err != nil {
+		responseError(err, w)
+		return
+	}
+
+	if !updateStub(id, stub) {
+		responseNotFound(id, w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stub); err != nil {
+		log.Println("Error writing handleUpdateStub response: %w", err)
+	}
+}
+
+func handleDeleteStub(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !deleteStub(id) {
+		responseNotFound(id, w)
+		return
+	}
+
+	if _, err := w.Write([]byte("OK")); err != nil {
+		log.Println("Error writing handleDeleteStub response: %w", err)
+	}
+}
+
+func responseNotFound(id string, w http.ResponseWriter) {
+	w.WriteHeader(http.StatusNotFound)
+	if _, err := w.Write([]byte(fmt.Sprintf("stub with id %s not found", id))); err != nil {
 		log.Println("Error writing response: %w", err)
 	}
 }
@@ -137,32 +338,201 @@ func validateStub(stub *Stub) error {
 	// method name must capital
 	stub.Method = cases.Title(language.Und, cases.NoLower).String(stub.Method)
 
-	switch {
-	case stub.Input.Contains != nil:
-		break
-	case stub.Input.Equals != nil:
-		break
-	case stub.Input.EqualsUnordered != nil:
-		break
-	case stub.Input.Matches != nil:
-		break
-	default:
+	// a conversation may answer the opening of any stream
+	if !stub.Input.hasRules() && !stub.Input.hasCombinators() && stub.Conversation == nil {
 		return fmt.Errorf("Input cannot be empty")
 	}
 
-	// TODO: validate all input case
+	if err := validateInput(stub.Input); err != nil {
+		return err
+	}
+
+	if stub.Scenario == "" && (stub.RequiredState != "" || stub.NewState != "") {
+		return fmt.Errorf("scenario can't be empty when required_state or new_state is set")
+	}
+
+	if err := validateFaults(stub.Faults); err != nil {
+		return err
+	}
 
-	if stub.Output.Error == "" && stub.Output.Data == nil && stub.Output.Code == nil {
+	if stub.Conversation != nil {
+		if err := stub.Conversation.validate(); err != nil {
+			return fmt.Errorf("conversation: %v", err)
+		}
+	}
+
+	if stub.Times < 0 {
+		return fmt.Errorf("times can't be negative")
+	}
+
+	switch stub.OnExhausted {
+	case "", OnExhaustedRepeat, OnExhaustedCycle, OnExhaustedFallthrough:
+	default:
+		return fmt.Errorf("on_exhausted must be one of %s, %s or %s", OnExhaustedRepeat, OnExhaustedCycle, OnExhaustedFallthrough)
+	}
+
+	if err := compileStubTemplates(stub); err != nil {
+		return err
+	}
+
+	if len(stub.Outputs) > 0 {
+		for i, output := range stub.Outputs {
+			if output.isEmpty() {
+				return fmt.Errorf("Outputs[%d] can't be empty", i)
+			}
+			if err := output.validate(); err != nil {
+				return fmt.Errorf("Outputs[%d]: %v", i, err)
+			}
+		}
+		return validateStubDescriptor(stub)
+	}
+
+	if stub.Output.isEmpty() && stub.Conversation == nil {
 		return fmt.Errorf("Output can't be empty")
 	}
+	if err := stub.Output.validate(); err != nil {
+		return err
+	}
+	return validateStubDescriptor(stub)
+}
+
+func validateInput(input Input) error {
+	if input.Compare != nil {
+		if _, err := parseComparisons(input.Compare); err != nil {
+			return fmt.Errorf("invalid compare rule: %v", err)
+		}
+	}
+
+	if err := validateRegexps(input.Matches); err != nil {
+		return fmt.Errorf("invalid matches rule: %v", err)
+	}
+	if input.Headers != nil {
+		for header, expr := range input.Headers.Matches {
+			if _, err := regexp.Compile(expr); err != nil {
+				return fmt.Errorf("invalid headers matches rule %s: %v", header, err)
+			}
+		}
+	}
+
+	if input.Paths != nil {
+		if err := validatePaths(input.Paths); err != nil {
+			return fmt.Errorf("invalid paths rule: %v", err)
+		}
+	}
+
+	if input.Expr != "" {
+		if _, err := compileExpr(input.Expr); err != nil {
+			return fmt.Errorf("invalid expr rule: %v", err)
+		}
+	}
+
+	if input.Stream != nil {
+		if err := validateStreamInput(*input.Stream); err != nil {
+			return err
+		}
+	}
+
+	for i, sub := range input.AllOf {
+		if err := validateNestedInput(sub); err != nil {
+			return fmt.Errorf("all_of[%d]: %v", i, err)
+		}
+	}
+	for i, sub := range input.AnyOf {
+		if err := validateNestedInput(sub); err != nil {
+			return fmt.Errorf("any_of[%d]: %v", i, err)
+		}
+	}
+	if input.Not != nil {
+		if err := validateNestedInput(*input.Not); err != nil {
+			return fmt.Errorf("not: %v", err)
+		}
+	}
+	return nil
+}
+
+// validateRegexps checks the regular expressions of a matches rule, which are its strings
+func validateRegexps(expect interface{}) error {
+	switch v := expect.(type) {
+	case string:
+		_, err := regexp.Compile(v)
+		return err
+	case map[string]interface{}:
+		for _, value := range v {
+			if err := validateRegexps(value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if err := validateRegexps(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nested inputs may only constrain headers, but can't be empty
+func validateNestedInput(input Input) error {
+	if !input.hasRules() && !input.hasCombinators() && input.Headers == nil {
+		return fmt.Errorf("input can't be empty")
+	}
+	return validateInput(input)
+}
+
+func (o Output) isEmpty() bool {
+	return o.Error == "" && o.Data == nil && o.Code == nil && len(o.Stream) == 0
+}
+
+func (o Output) validate() error {
+	if o.Delay != nil {
+		if err := o.Delay.validate(); err != nil {
+			return err
+		}
+	}
+	if o.StreamDelay != nil {
+		if err := o.StreamDelay.validate(); err != nil {
+			return fmt.Errorf("stream_delay: %v", err)
+		}
+	}
+	if o.Periodic != nil {
+		if err := o.Periodic.validate(); err != nil {
+			return err
+		}
+	}
+
+	if len(o.Details) > 0 && o.Error == "" && (o.Code == nil || *o.Code == codes.OK) {
+		return fmt.Errorf("details need an error")
+	}
+	for i, detail := range o.Details {
+		if t, ok := detail["@type"].(string); !ok || t == "" {
+			return fmt.Errorf("details[%d] must have an @type", i)
+		}
+	}
 	return nil
 }
 
+// findStubResponse is the output resolved for a call
+type findStubResponse struct {
+	*Output
+	StreamDelays []*Delay      `json:"stream_delays,omitempty"`
+	Conversation *Conversation `json:"conversation,omitempty"`
+}
+
+// requestIDHeader tells the generated server the journal entry of the call,
+// which it ends through /requests/{id}/end
+const requestIDHeader = "X-Gripmock-Request-Id"
+
 type findStubPayload struct {
 	Service string                 `json:"service"`
 	Method  string                 `json:"method"`
 	Data    map[string]interface{} `json:"data"`
 	Headers map[string]string      `json:"headers,omitempty"`
+
+	// Stream is every message of a client stream, sent instead of Data
+	Stream []map[string]interface{} `json:"stream,omitempty"`
+	// Event is set instead of Data by streams telling they opened
+	Event string `json:"event,omitempty"`
 }
 
 func handleFindStub(w http.ResponseWriter, r *http.Request) {
@@ -185,7 +555,11 @@ func handleFindStub(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(output); err != nil {
+	if output.requestID != 0 {
+		w.Header().Set(requestIDHeader, strconv.Itoa(output.requestID))
+	}
+	response := findStubResponse{Output: output, StreamDelays: output.streamDelays, Conversation: output.conversation}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Println("Error writing handleFindStub response: %w", err)
 	}
 }
@@ -212,7 +586,40 @@ func handleResetStub(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func handleClearRequests(w http.ResponseWriter, r *http.Request) {
+	clearRequests()
+	if _, err := w.Write([]byte("OK")); err != nil {
+		log.Println("Error writing handleClearRequests response: %w", err)
+	}
+}
+
+func handleEndRequest(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		responseError(fmt.Errorf("invalid request id %s", id), w)
+		return
+	}
+
+	if !endRequest(n, time.Now()) {
+		w.WriteHeader(http.StatusNotFound)
+		if _, err := w.Write([]byte(fmt.Sprintf("request with id %s not found", id))); err != nil {
+			log.Println("Error writing handleEndRequest response: %w", err)
+		}
+		return
+	}
+	if _, err := w.Write([]byte("OK")); err != nil {
+		log.Println("Error writing handleEndRequest response: %w", err)
+	}
+}
+
 func listRequests(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseRequestFilter(r.URL.Query())
+	if err != nil {
+		responseError(err, w)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(allRequests())
+	json.NewEncoder(w).Encode(allRequests(filter))
 }
@@ -2,6 +2,7 @@ package stub
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -10,6 +11,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/go-chi/chi"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -46,7 +48,7 @@ func TestStub(t *testing.T) {
 				return httptest.NewRequest("POST", "/add", read)
 			},
 			handler: addStub,
-			expect:  `Success add stub`,
+			verify:  verifyStubAdded,
 		},
 		{
 			name: "list stub",
@@ -54,6 +56,7 @@ func TestStub(t *testing.T) {
 				clearStorage()
 				// Add the test stub
 				stub := &Stub{
+					ID:      "3f2b5e7c-list-stub",
 					Service: "Testing",
 					Method:  "TestMethod",
 					Input: Input{
@@ -74,7 +77,7 @@ func TestStub(t *testing.T) {
 				return httptest.NewRequest("GET", "/", nil)
 			},
 			handler: listStub,
-			expect:  "{\"Testing\":{\"TestMethod\":[{\"Input\":{\"equals\":{\"Hola\":\"Mundo\"},\"equals_unordered\":null,\"contains\":null,\"matches\":null},\"Output\":{\"data\":{\"Hello\":\"World\"},\"error\":\"\"}}]}}\n",
+			expect:  "{\"Testing\":{\"TestMethod\":[{\"ID\":\"3f2b5e7c-list-stub\",\"Input\":{\"equals\":{\"Hola\":\"Mundo\"},\"equals_unordered\":null,\"contains\":null,\"matches\":null},\"Output\":{\"data\":{\"Hello\":\"World\"},\"error\":\"\"}}]}}\n",
 		},
 		{
 			name: "find stub equals",
@@ -114,7 +117,7 @@ func TestStub(t *testing.T) {
 				return httptest.NewRequest("POST", "/add", read)
 			},
 			handler: addStub,
-			expect:  `Success add stub`,
+			verify:  verifyStubAdded,
 		},
 		{
 			name: "find nested stub equals",
@@ -131,7 +134,24 @@ func TestStub(t *testing.T) {
 				return httptest.NewRequest("GET", "/requests", nil)
 			},
 			handler: listRequests,
-			expect:  "[{\"record\":{\"service\":\"Testing\",\"method\":\"TestMethod\",\"data\":{\"Hola\":\"Mundo\"}},\"count\":1},{\"record\":{\"service\":\"NestedTesting\",\"method\":\"TestMethod\",\"data\":{\"age\":1,\"cities\":[\"Istanbul\",\"Jakarta\"],\"girl\":true,\"greetings\":{\"hola\":\"mundo\",\"merhaba\":\"dunya\"},\"name\":\"Afra Gokce\",\"null\":null}},\"count\":1}]\n",
+			verify: func(t *testing.T, w *httptest.ResponseRecorder) {
+				requests := []request{}
+				require.NoError(t, json.NewDecoder(w.Result().Body).Decode(&requests))
+				require.Len(t, requests, 2)
+
+				assert.Equal(t, "Testing", requests[0].Service)
+				assert.Equal(t, "TestMethod", requests[0].Method)
+				assert.Equal(t, map[string]interface{}{"Hola": "Mundo"}, requests[0].Data)
+				assert.Equal(t, "3f2b5e7c-list-stub", requests[0].StubID)
+				assert.Equal(t, OutcomeMatched, requests[0].Outcome)
+				assert.Equal(t, map[string]interface{}{"Hello": "World"}, requests[0].Response)
+				assert.False(t, requests[0].Time.IsZero())
+
+				assert.Equal(t, "NestedTesting", requests[1].Service)
+				assert.Equal(t, "Afra Gokce", requests[1].Data["name"])
+				assert.NotEmpty(t, requests[1].StubID)
+				assert.False(t, requests[1].Time.Before(requests[0].Time))
+			},
 		},
 		{
 			name: "add stub equals_unordered",
@@ -153,7 +173,7 @@ func TestStub(t *testing.T) {
 				return httptest.NewRequest("POST", "/add", bytes.NewReader([]byte(payload)))
 			},
 			handler: addStub,
-			expect:  `Success add stub`,
+			verify:  verifyStubAdded,
 		},
 		{
 			name: "find stub equals_unordered",
@@ -206,7 +226,7 @@ func TestStub(t *testing.T) {
 				return httptest.NewRequest("POST", "/add", bytes.NewReader([]byte(payload)))
 			},
 			handler: addStub,
-			expect:  `Success add stub`,
+			verify:  verifyStubAdded,
 		},
 		{
 			name: "find stub contains",
@@ -250,7 +270,7 @@ func TestStub(t *testing.T) {
 				return httptest.NewRequest("POST", "/add", bytes.NewReader([]byte(payload)))
 			},
 			handler: addStub,
-			expect:  `Success add stub`,
+			verify:  verifyStubAdded,
 		},
 		{
 			name: "add error stub with result code contains",
@@ -276,7 +296,7 @@ func TestStub(t *testing.T) {
 				return httptest.NewRequest("POST", "/add", bytes.NewReader([]byte(payload)))
 			},
 			handler: addStub,
-			expect:  `Success add stub`,
+			verify:  verifyStubAdded,
 		},
 		{
 			name: "find error stub with result code contains",
@@ -300,6 +320,69 @@ func TestStub(t *testing.T) {
 			handler: handleFindStub,
 			expect:  "{\"data\":null,\"error\":\"error msg\",\"code\":3}\n",
 		},
+		{
+			name: "add error stub with details",
+			mock: func() *http.Request {
+				payload := `{
+								"service": "ErrorStabWithDetails",
+								"method":"TestMethod",
+								"input":{
+									"equals":{
+												"key": "value"
+									}
+								},
+								"output":{
+									"error":"quota exceeded",
+									"code": 8,
+									"details":[
+										{"@type":"google.rpc.ErrorInfo", "reason":"QUOTA_{{ .Request.key }}"},
+										{"@type":"google.rpc.RetryInfo", "retry_delay":"1.5s"}
+									]
+								}
+							}`
+				return httptest.NewRequest("POST", "/add", bytes.NewReader([]byte(payload)))
+			},
+			handler: addStub,
+			verify:  verifyStubAdded,
+		},
+		{
+			name: "find error stub with details",
+			mock: func() *http.Request {
+				payload := `{
+						"service": "ErrorStabWithDetails",
+						"method":"TestMethod",
+						"data":{
+								"key": "value"
+						}
+					}`
+				return httptest.NewRequest("GET", "/find", bytes.NewReader([]byte(payload)))
+			},
+			handler: handleFindStub,
+			expect:  "{\"data\":null,\"error\":\"quota exceeded\",\"code\":8,\"details\":[{\"@type\":\"google.rpc.ErrorInfo\",\"reason\":\"QUOTA_value\"},{\"@type\":\"google.rpc.RetryInfo\",\"retry_delay\":\"1.5s\"}]}\n",
+		},
+		{
+			name: "add stub with details and no error",
+			mock: func() *http.Request {
+				payload := `{
+								"service": "ErrorStabWithDetails",
+								"method":"TestMethod",
+								"input":{
+									"equals":{
+												"key": "other"
+									}
+								},
+								"output":{
+									"data":{},
+									"details":[
+										{"@type":"google.rpc.ErrorInfo", "reason":"QUOTA"}
+									]
+								}
+							}`
+				return httptest.NewRequest("POST", "/add", bytes.NewReader([]byte(payload)))
+			},
+			handler: addStub,
+			expect:  "details need an error",
+		},
 
 		{
 			name: "add error stub without result code contains",
@@ -324,7 +407,7 @@ func TestStub(t *testing.T) {
 				return httptest.NewRequest("POST", "/add", bytes.NewReader([]byte(payload)))
 			},
 			handler: addStub,
-			expect:  `Success add stub`,
+			verify:  verifyStubAdded,
 		},
 		{
 			name: "find error stub without result code contains",
@@ -390,7 +473,7 @@ func TestStub(t *testing.T) {
 				return httptest.NewRequest("POST", "/add", bytes.NewReader([]byte(payload)))
 			},
 			handler: addStub,
-			expect:  "Success add stub",
+			verify:  verifyStubAdded,
 		},
 		{
 			name: "find stub matches regex",
@@ -434,7 +517,7 @@ func TestStub(t *testing.T) {
 				return httptest.NewRequest("POST", "/add", bytes.NewReader([]byte(payload)))
 			},
 			handler: addStub,
-			expect:  "Success add stub",
+			verify:  verifyStubAdded,
 		},
 		{
 			name: "find nested stub matches regex",
@@ -803,3 +886,127 @@ func TestStub(t *testing.T) {
 		})
 	}
 }
+
+func verifyStubAdded(t *testing.T, w *httptest.ResponseRecorder) {
+	res := addStubResponse{}
+	require.NoError(t, json.NewDecoder(w.Result().Body).Decode(&res))
+	assert.NotEmpty(t, res.ID)
+}
+
+func TestStubByID(t *testing.T) {
+	clearStorage()
+	payload := `{
+			"id": "a6f9c1d2-by-id",
+			"service": "Testing",
+			"method": "TestMethod",
+			"input": {"equals": {"Hola": "Mundo"}},
+			"output": {"data": {"Hello": "World"}}
+		}`
+
+	cases := []struct {
+		name    string
+		mock    func() *http.Request
+		handler http.HandlerFunc
+		code    int
+		expect  string
+	}{
+		{
+			name: "add stub with id",
+			mock: func() *http.Request {
+				return httptest.NewRequest("POST", "/add", bytes.NewReader([]byte(payload)))
+			},
+			handler: addStub,
+			code:    http.StatusOK,
+			expect:  "{\"id\":\"a6f9c1d2-by-id\"}\n",
+		},
+		{
+			name: "add stub with duplicate id",
+			mock: func() *http.Request {
+				return httptest.NewRequest("POST", "/add", bytes.NewReader([]byte(payload)))
+			},
+			handler: addStub,
+			code:    http.StatusInternalServerError,
+			expect:  "stub with id a6f9c1d2-by-id already exists",
+		},
+		{
+			name: "get stub by id",
+			mock: func() *http.Request {
+				return withURLParam(httptest.NewRequest("GET", "/stubs/a6f9c1d2-by-id", nil), "id", "a6f9c1d2-by-id")
+			},
+			handler: handleGetStub,
+			code:    http.StatusOK,
+			expect:  "{\"id\":\"a6f9c1d2-by-id\",\"service\":\"Testing\",\"method\":\"TestMethod\",\"input\":{\"equals\":{\"Hola\":\"Mundo\"},\"equals_unordered\":null,\"contains\":null,\"matches\":null},\"output\":{\"data\":{\"Hello\":\"World\"},\"error\":\"\"}}\n",
+		},
+		{
+			name: "update stub by id",
+			mock: func() *http.Request {
+				update := `{
+						"service": "Testing",
+						"method": "TestMethod",
+						"input": {"equals": {"Hola": "Mundo"}},
+						"output": {"data": {"Hello": "Updated"}}
+					}`
+				req := httptest.NewRequest("PUT", "/stubs/a6f9c1d2-by-id", bytes.NewReader([]byte(update)))
+				return withURLParam(req, "id", "a6f9c1d2-by-id")
+			},
+			handler: handleUpdateStub,
+			code:    http.StatusOK,
+			expect:  "{\"id\":\"a6f9c1d2-by-id\",\"service\":\"Testing\",\"method\":\"TestMethod\",\"input\":{\"equals\":{\"Hola\":\"Mundo\"},\"equals_unordered\":null,\"contains\":null,\"matches\":null},\"output\":{\"data\":{\"Hello\":\"Updated\"},\"error\":\"\"}}\n",
+		},
+		{
+			name: "find updated stub",
+			mock: func() *http.Request {
+				find := `{"service":"Testing","method":"TestMethod","data":{"Hola":"Mundo"}}`
+				return httptest.NewRequest("POST", "/find", bytes.NewReader([]byte(find)))
+			},
+			handler: handleFindStub,
+			code:    http.StatusOK,
+			expect:  "{\"data\":{\"Hello\":\"Updated\"},\"error\":\"\"}\n",
+		},
+		{
+			name: "delete stub by id",
+			mock: func() *http.Request {
+				return withURLParam(httptest.NewRequest("DELETE", "/stubs/a6f9c1d2-by-id", nil), "id", "a6f9c1d2-by-id")
+			},
+			handler: handleDeleteStub,
+			code:    http.StatusOK,
+			expect:  "OK",
+		},
+		{
+			name: "get deleted stub",
+			mock: func() *http.Request {
+				return withURLParam(httptest.NewRequest("GET", "/stubs/a6f9c1d2-by-id", nil), "id", "a6f9c1d2-by-id")
+			},
+			handler: handleGetStub,
+			code:    http.StatusNotFound,
+			expect:  "stub with id a6f9c1d2-by-id not found",
+		},
+		{
+			name: "delete unknown stub",
+			mock: func() *http.Request {
+				return withURLParam(httptest.NewRequest("DELETE", "/stubs/unknown", nil), "id", "unknown")
+			},
+			handler: handleDeleteStub,
+			code:    http.StatusNotFound,
+			expect:  "stub with id unknown not found",
+		},
+	}
+
+	for _, v := range cases {
+		t.Run(v.name, func(t *testing.T) {
+			wrt := httptest.NewRecorder()
+			v.handler(wrt, v.mock())
+
+			assert.Equal(t, v.code, wrt.Code)
+			res, err := ioutil.ReadAll(wrt.Result().Body)
+			assert.NoError(t, err)
+			assert.Equal(t, v.expect, string(res))
+		})
+	}
+}
+
+func withURLParam(r *http.Request, key, value string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add(key, value)
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
@@ -0,0 +1,313 @@
+package stub
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// templateData is what a response template can refer to
+type templateData struct {
+	Request map[string]interface{}
+	Headers map[string]string
+	Now     time.Time
+	// Stream is every message of a client stream
+	Stream []interface{}
+	// Seq counts the messages of a periodic stream, from 1
+	Seq int
+}
+
+// rnd backs the random template functions. guarded by mx.
+var rnd = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+var templateFuncs = template.FuncMap{
+	// uuids are drawn from rnd too, so that a seed reproduces them
+	"uuid": func() (string, error) {
+		id, err := uuid.NewRandomFromReader(rnd)
+		if err != nil {
+			return "", err
+		}
+		return id.String(), nil
+	},
+	"now": time.Now,
+	"randInt": func(min, max int) int {
+		if max <= min {
+			return min
+		}
+		return min + rnd.Intn(max-min)
+	},
+	"randFloat": func(min, max float64) float64 {
+		return min + rnd.Float64()*(max-min)
+	},
+	"randString": func(n int) string {
+		const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = letters[rnd.Intn(len(letters))]
+		}
+		return string(b)
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// responseTemplates caches parsed templates, keyed by their source
+var responseTemplates = map[string]*template.Template{}
+var templateMx = sync.Mutex{}
+
+func isTemplate(s string) bool {
+	return strings.Contains(s, "{{")
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	templateMx.Lock()
+	defer templateMx.Unlock()
+
+	if tmpl, ok := responseTemplates[text]; ok {
+		return tmpl, nil
+	}
+
+	tmpl, err := template.New("").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	responseTemplates[text] = tmpl
+	return tmpl, nil
+}
+
+// compileTemplates parses every template string in the output
+func compileTemplates(output Output) error {
+	var errs []string
+	walkStrings(output, func(s string) {
+		if !isTemplate(s) {
+			return
+		}
+		if _, err := parseTemplate(s); err != nil {
+			errs = append(errs, err.Error())
+		}
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid template: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// compileStubTemplates parses the templates of every output of the stub
+func compileStubTemplates(stub *Stub) error {
+	if err := compileTemplates(stub.Output); err != nil {
+		return err
+	}
+	for i, output := range stub.Outputs {
+		if err := compileTemplates(output); err != nil {
+			return fmt.Errorf("Outputs[%d]: %v", i, err)
+		}
+	}
+	if stub.Conversation != nil {
+		for i, timer := range stub.Conversation.Timers {
+			if err := compileTemplates(Output{Data: timer.Data}); err != nil {
+				return fmt.Errorf("conversation timers[%d]: %v", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func walkStrings(output Output, fn func(string)) {
+	var walk func(interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case string:
+			fn(v)
+		case map[string]interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(output.Data)
+	for _, message := range output.Stream {
+		walk(message)
+	}
+	for _, detail := range output.Details {
+		walk(detail)
+	}
+	fn(output.Error)
+	for _, value := range output.Headers {
+		fn(value)
+	}
+	for _, value := range output.Trailers {
+		fn(value)
+	}
+}
+
+func newTemplateData(stub *findStubPayload) templateData {
+	data := templateData{
+		Request: map[string]interface{}{},
+		Headers: stub.Headers,
+		Now:     time.Now(),
+	}
+	if stub.Data != nil {
+		data.Request = templateValue(stub.Data).(map[string]interface{})
+	}
+	if stub.Stream != nil {
+		data.Stream = templateValue(messageList(stub.Stream)).([]interface{})
+	}
+	if data.Headers == nil {
+		data.Headers = map[string]string{}
+	}
+	return data
+}
+
+// renderOutput returns a copy of the output with its templates
+// executed against the request. caller must hold mx.
+func renderOutput(output *Output, stub *findStubPayload) (*Output, error) {
+	return renderOutputData(output, newTemplateData(stub))
+}
+
+// renderMessage executes the templates of a periodic message for its
+// sequence number. caller must hold mx.
+func renderMessage(message map[string]interface{}, stub *findStubPayload, seq int) (map[string]interface{}, error) {
+	data := newTemplateData(stub)
+	data.Seq = seq
+	rendered, err := renderOutputData(&Output{Data: message}, data)
+	if err != nil {
+		return nil, err
+	}
+	return rendered.Data, nil
+}
+
+func renderOutputData(output *Output, data templateData) (*Output, error) {
+
+	render := func(s string) (string, error) {
+		if !isTemplate(s) {
+			return s, nil
+		}
+		tmpl, err := parseTemplate(s)
+		if err != nil {
+			return "", err
+		}
+		buf := &bytes.Buffer{}
+		if err := tmpl.Execute(buf, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+
+	var renderValue func(interface{}) (interface{}, error)
+	renderValue = func(value interface{}) (interface{}, error) {
+		switch v := value.(type) {
+		case string:
+			return render(v)
+		case map[string]interface{}:
+			rendered := make(map[string]interface{}, len(v))
+			for key, item := range v {
+				r, err := renderValue(item)
+				if err != nil {
+					return nil, err
+				}
+				rendered[key] = r
+			}
+			return rendered, nil
+		case []interface{}:
+			rendered := make([]interface{}, len(v))
+			for i, item := range v {
+				r, err := renderValue(item)
+				if err != nil {
+					return nil, err
+				}
+				rendered[i] = r
+			}
+			return rendered, nil
+		}
+		return value, nil
+	}
+
+	// periodic messages are rendered on every tick instead, see handleRender
+	rendered := *output
+	if output.Data != nil && output.Periodic == nil {
+		d, err := renderValue(output.Data)
+		if err != nil {
+			return nil, fmt.Errorf("rendering output template: %v", err)
+		}
+		rendered.Data = d.(map[string]interface{})
+	}
+
+	if output.Stream != nil && output.Periodic == nil {
+		rendered.Stream = make([]map[string]interface{}, len(output.Stream))
+		for i, message := range output.Stream {
+			m, err := renderValue(message)
+			if err != nil {
+				return nil, fmt.Errorf("rendering stream template: %v", err)
+			}
+			rendered.Stream[i] = m.(map[string]interface{})
+		}
+	}
+
+	if output.Details != nil {
+		rendered.Details = make([]map[string]interface{}, len(output.Details))
+		for i, detail := range output.Details {
+			d, err := renderValue(detail)
+			if err != nil {
+				return nil, fmt.Errorf("rendering details template: %v", err)
+			}
+			rendered.Details[i] = d.(map[string]interface{})
+		}
+	}
+
+	var err error
+	if rendered.Error, err = render(output.Error); err != nil {
+		return nil, fmt.Errorf("rendering error template: %v", err)
+	}
+
+	if output.Headers != nil {
+		rendered.Headers = make(map[string]string, len(output.Headers))
+		for key, value := range output.Headers {
+			if rendered.Headers[key], err = render(value); err != nil {
+				return nil, fmt.Errorf("rendering header template: %v", err)
+			}
+		}
+	}
+
+	if output.Trailers != nil {
+		rendered.Trailers = make(map[string]string, len(output.Trailers))
+		for key, value := range output.Trailers {
+			if rendered.Trailers[key], err = render(value); err != nil {
+				return nil, fmt.Errorf("rendering trailer template: %v", err)
+			}
+		}
+	}
+	return &rendered, nil
+}
+
+// templateValue prepares request data for templates: json numbers are
+// decoded as float64, which would print large integers in exponent form
+func templateValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[key] = templateValue(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = templateValue(item)
+		}
+		return converted
+	}
+	return value
+}
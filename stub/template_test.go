@@ -0,0 +1,115 @@
+package stub
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_renderOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  Output
+		payload findStubPayload
+		want    Output
+		wantErr string
+	}{
+		{
+			name: "request fields and headers",
+			output: Output{
+				Data: map[string]interface{}{
+					"id":    "{{ .Request.user_id }}",
+					"owner": "{{ .Headers.tenant | upper }}",
+					"items": []interface{}{"{{ index .Request.tags 0 }}", float64(1)},
+				},
+				Headers:  map[string]string{"x-echo": "{{ .Request.user_id }}"},
+				Trailers: map[string]string{"x-next-cursor": "{{ index .Request.tags 1 }}"},
+			},
+			payload: findStubPayload{
+				Data: map[string]interface{}{
+					"user_id": float64(12345678),
+					"tags":    []interface{}{"a", "b"},
+				},
+				Headers: map[string]string{"tenant": "acme"},
+			},
+			want: Output{
+				Data: map[string]interface{}{
+					"id":    "12345678",
+					"owner": "ACME",
+					"items": []interface{}{"a", float64(1)},
+				},
+				Headers:  map[string]string{"x-echo": "12345678"},
+				Trailers: map[string]string{"x-next-cursor": "b"},
+			},
+		},
+		{
+			name:    "error message",
+			output:  Output{Error: "user {{ .Request.name }} not found"},
+			payload: findStubPayload{Data: map[string]interface{}{"name": "alice"}},
+			want:    Output{Error: "user alice not found"},
+		},
+		{
+			name:    "missing field",
+			output:  Output{Data: map[string]interface{}{"id": "{{ .Request.user_id }}"}},
+			payload: findStubPayload{},
+			wantErr: "rendering output template",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderOutput(&tt.output, &tt.payload)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, *got)
+		})
+	}
+}
+
+func Test_renderOutputFuncs(t *testing.T) {
+	output := Output{Data: map[string]interface{}{
+		"id":    "{{ uuid }}",
+		"year":  "{{ now.Year }}",
+		"roll":  "{{ randInt 1 7 }}",
+		"token": "{{ randString 8 }}",
+	}}
+	got, err := renderOutput(&output, &findStubPayload{})
+	require.NoError(t, err)
+	assert.Len(t, got.Data["id"], 36)
+	assert.Regexp(t, `^\d{4}$`, got.Data["year"])
+	assert.Regexp(t, `^[1-6]$`, got.Data["roll"])
+	assert.Regexp(t, `^[a-zA-Z0-9]{8}$`, got.Data["token"])
+
+	// the stored output is left untouched
+	assert.Equal(t, "{{ uuid }}", output.Data["id"])
+
+	// a seed reproduces the random values, uuids included. a single string
+	// keeps the draws in order, the fields of data are rendered in any order.
+	seeded := Output{Data: map[string]interface{}{"id": "{{ uuid }} {{ randString 8 }}"}}
+	seedRandom(7)
+	first, err := renderOutput(&seeded, &findStubPayload{})
+	require.NoError(t, err)
+	seedRandom(7)
+	second, err := renderOutput(&seeded, &findStubPayload{})
+	require.NoError(t, err)
+	assert.Equal(t, first.Data["id"], second.Data["id"])
+}
+
+func Test_validateStubTemplates(t *testing.T) {
+	err := validateStub(&Stub{
+		Service: "Users",
+		Method:  "Get",
+		Input:   Input{Contains: map[string]interface{}{"id": 1}},
+		Outputs: []Output{
+			{Data: map[string]interface{}{"name": "ok"}},
+			{Data: map[string]interface{}{"name": "{{ .Request.name "}},
+		},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Outputs[1]: invalid template")
+}
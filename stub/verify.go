@@ -0,0 +1,126 @@
+package stub
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+type verifyPayload struct {
+	Service string      `json:"service"`
+	Method  string      `json:"method"`
+	Input   *Input      `json:"input,omitempty"`
+	Count   verifyCount `json:"count"`
+}
+
+// verifyCount is the expected number of matching calls.
+// when nothing is set, at least one call is expected.
+type verifyCount struct {
+	Exactly *int `json:"exactly,omitempty"`
+	AtLeast *int `json:"at_least,omitempty"`
+	AtMost  *int `json:"at_most,omitempty"`
+}
+
+type verifyResult struct {
+	Pass     bool       `json:"pass"`
+	Expected string     `json:"expected"`
+	Actual   int        `json:"actual"`
+	Requests []*request `json:"requests"`
+}
+
+func (c verifyCount) check(actual int) bool {
+	if c.Exactly == nil && c.AtLeast == nil && c.AtMost == nil {
+		return actual >= 1
+	}
+	if c.Exactly != nil && actual != *c.Exactly {
+		return false
+	}
+	if c.AtLeast != nil && actual < *c.AtLeast {
+		return false
+	}
+	if c.AtMost != nil && actual > *c.AtMost {
+		return false
+	}
+	return true
+}
+
+func (c verifyCount) String() string {
+	switch {
+	case c.Exactly != nil:
+		return fmt.Sprintf("exactly %d", *c.Exactly)
+	case c.AtLeast != nil && c.AtMost != nil:
+		return fmt.Sprintf("between %d and %d", *c.AtLeast, *c.AtMost)
+	case c.AtLeast != nil:
+		return fmt.Sprintf("at least %d", *c.AtLeast)
+	case c.AtMost != nil:
+		return fmt.Sprintf("at most %d", *c.AtMost)
+	default:
+		return "at least 1"
+	}
+}
+
+// inputMatches tells whether a recorded request satisfies the input rules
+func inputMatches(input Input, payload *findStubPayload) bool {
+	_, ok := matchInput(input, payload, nil)
+	return ok
+}
+
+func verifyRequests(payload *verifyPayload) verifyResult {
+	mx.Lock()
+	defer mx.Unlock()
+
+	result := verifyResult{
+		Expected: payload.Count.String(),
+		Requests: []*request{},
+	}
+	for _, req := range requestStorage.entries() {
+		if req.Service != payload.Service || req.Method != payload.Method {
+			continue
+		}
+		if payload.Input != nil && !inputMatches(*payload.Input, &req.findStubPayload) {
+			continue
+		}
+		result.Actual++
+		result.Requests = append(result.Requests, req)
+	}
+	result.Pass = payload.Count.check(result.Actual)
+	return result
+}
+
+func handleVerify(w http.ResponseWriter, r *http.Request) {
+	payload := new(verifyPayload)
+	err := json.NewDecoder(r.Body).Decode(payload)
+	if err != nil {
+		responseError(err, w)
+		return
+	}
+
+	if payload.Service == "" || payload.Method == "" {
+		responseError(fmt.Errorf("service and method can't be empty"), w)
+		return
+	}
+
+	// a malformed rule would silently match nothing
+	if payload.Input != nil {
+		if err := validateInput(*payload.Input); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			if _, err := w.Write([]byte(err.Error())); err != nil {
+				log.Println("Error writing handleVerify response:", err)
+			}
+			return
+		}
+	}
+
+	// due to golang implementation
+	// method name must capital
+	payload.Method = cases.Title(language.Und, cases.NoLower).String(payload.Method)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(verifyRequests(payload)); err != nil {
+		log.Println("Error writing handleVerify response: %w", err)
+	}
+}
@@ -0,0 +1,112 @@
+package stub
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	clearStorage()
+	require.NoError(t, storeStub(&Stub{
+		Service: "Payments",
+		Method:  "Charge",
+		Input:   Input{Contains: map[string]interface{}{"currency": "IDR"}},
+		Output:  Output{Data: map[string]interface{}{"status": "OK"}},
+	}))
+
+	calls := []*findStubPayload{
+		{Data: map[string]interface{}{"currency": "IDR", "amount": "100"}, Headers: map[string]string{"x-tenant": "acme"}},
+		{Data: map[string]interface{}{"currency": "IDR", "amount": "100"}, Headers: map[string]string{"x-tenant": "acme"}},
+		{Data: map[string]interface{}{"currency": "IDR", "amount": "250"}},
+	}
+	for _, call := range calls {
+		call.Service, call.Method = "Payments", "Charge"
+		_, err := findStub(call)
+		require.NoError(t, err)
+	}
+
+	tests := []struct {
+		name       string
+		payload    string
+		wantPass   bool
+		wantActual int
+		wantExpect string
+	}{
+		{
+			name:       "any call",
+			payload:    `{"service":"Payments","method":"charge"}`,
+			wantPass:   true,
+			wantActual: 3,
+			wantExpect: "at least 1",
+		},
+		{
+			name:       "exactly with input",
+			payload:    `{"service":"Payments","method":"Charge","input":{"contains":{"amount":"250"}},"count":{"exactly":1}}`,
+			wantPass:   true,
+			wantActual: 1,
+			wantExpect: "exactly 1",
+		},
+		{
+			name:       "exactly fails",
+			payload:    `{"service":"Payments","method":"Charge","input":{"contains":{"amount":"100"}},"count":{"exactly":1}}`,
+			wantPass:   false,
+			wantActual: 2,
+			wantExpect: "exactly 1",
+		},
+		{
+			name:       "headers only input",
+			payload:    `{"service":"Payments","method":"Charge","input":{"headers":{"equals":{"x-tenant":"acme"}}},"count":{"at_least":2}}`,
+			wantPass:   true,
+			wantActual: 2,
+			wantExpect: "at least 2",
+		},
+		{
+			name:       "at most",
+			payload:    `{"service":"Payments","method":"Charge","count":{"at_most":2}}`,
+			wantPass:   false,
+			wantActual: 3,
+			wantExpect: "at most 2",
+		},
+		{
+			name:       "never called",
+			payload:    `{"service":"Payments","method":"Refund","count":{"exactly":0}}`,
+			wantPass:   true,
+			wantActual: 0,
+			wantExpect: "exactly 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handleVerify(w, httptest.NewRequest("POST", "/verify", bytes.NewReader([]byte(tt.payload))))
+			require.Equal(t, 200, w.Code)
+
+			got := verifyResult{}
+			require.NoError(t, json.NewDecoder(w.Result().Body).Decode(&got))
+			assert.Equal(t, tt.wantPass, got.Pass)
+			assert.Equal(t, tt.wantActual, got.Actual)
+			assert.Equal(t, tt.wantExpect, got.Expected)
+		})
+	}
+}
+
+func TestVerifyInvalidInput(t *testing.T) {
+	clearStorage()
+
+	payloads := []string{
+		`{"service":"Payments","method":"Charge","input":{"compare":{"amount":{"between":1}}},"count":{"exactly":0}}`,
+		`{"service":"Payments","method":"Charge","input":{"matches":{"currency":"[ID"}},"count":{"exactly":0}}`,
+		`{"service":"Payments","method":"Charge","input":{"expr":"request.amount >"},"count":{"exactly":0}}`,
+	}
+	for _, payload := range payloads {
+		w := httptest.NewRecorder()
+		handleVerify(w, httptest.NewRequest("POST", "/verify", bytes.NewReader([]byte(payload))))
+		assert.Equal(t, 400, w.Code, payload)
+	}
+}
@@ -0,0 +1,87 @@
+package stub
+
+import (
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// watchInterval is how often the stub folder is scanned for changes
+var watchInterval = time.Second
+
+// fileState tells a stub file apart from its previous versions
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// scanStubFiles lists the stub files of a folder tree with their state
+func scanStubFiles(root string) map[string]fileState {
+	files := map[string]fileState{}
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// the folder may be changing while it's walked, what's left is scanned next time
+			return nil
+		}
+		if entry.IsDir() || !isStubFile(entry.Name()) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		files[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Can't scan stubs of %s. %v\n", root, err)
+	}
+	return files
+}
+
+// changedFiles returns the files created, modified or deleted between two scans
+func changedFiles(before, after map[string]fileState) []string {
+	var changed []string
+	for path, state := range after {
+		if previous, ok := before[path]; !ok || previous != state {
+			changed = append(changed, path)
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// reloadStubFile replaces the stubs loaded from a file by its current ones.
+// the stubs of a deleted file are only removed.
+func reloadStubFile(path string, exists bool) {
+	if !exists {
+		mx.Lock()
+		removed := stubStorage.removeSource(path)
+		delete(loadErrors, path)
+		mx.Unlock()
+		log.Printf("Stub file %s deleted, removed %d stubs\n", path, removed)
+		return
+	}
+	removed, added := stubStorage.readStubFile(path)
+	log.Printf("Stub file %s changed, removed %d stubs and loaded %d stubs\n", path, removed, added)
+}
+
+// watchStubs reloads the stubs of the files created, modified or deleted under root,
+// comparing each scan with the files of the previous one
+func watchStubs(root string, files map[string]fileState) {
+	for range time.Tick(watchInterval) {
+		current := scanStubFiles(root)
+		for _, path := range changedFiles(files, current) {
+			_, exists := current[path]
+			reloadStubFile(path, exists)
+		}
+		files = current
+	}
+}
@@ -0,0 +1,148 @@
+package stub
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_changedFiles(t *testing.T) {
+	now := time.Now()
+	before := map[string]fileState{
+		"a.json": {modTime: now, size: 10},
+		"b.json": {modTime: now, size: 10},
+		"c.yaml": {modTime: now, size: 10},
+	}
+	after := map[string]fileState{
+		"a.json": {modTime: now, size: 10},
+		"b.json": {modTime: now.Add(time.Second), size: 10},
+		"d.yml":  {modTime: now, size: 5},
+	}
+
+	assert.Equal(t, []string{"b.json", "c.yaml", "d.yml"}, changedFiles(before, after))
+	assert.Empty(t, changedFiles(after, after))
+}
+
+func Test_scanStubFiles(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "users"), 0o755))
+	for _, name := range []string{"a.json", "users/b.yaml", "users/c.yml", "notes.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0o644))
+	}
+
+	files := scanStubFiles(dir)
+	assert.Len(t, files, 3)
+	assert.Contains(t, files, filepath.Join(dir, "users", "b.yaml"))
+	assert.NotContains(t, files, filepath.Join(dir, "notes.txt"))
+}
+
+func Test_reloadStubFile(t *testing.T) {
+	clearStorage()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "user.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+- service: user
+  method: getname
+  input: {equals: {id: 1}}
+  output: {data: {name: user1}}
+- service: user
+  method: getname
+  input: {equals: {id: 2}}
+  output: {data: {name: user2}}
+`), 0o644))
+	// the folder is given with a trailing slash, the scanned paths never have it
+	require.Equal(t, 2, readStubFromFile(dir+"/"))
+	require.NoError(t, storeStub(&Stub{
+		Service: "user",
+		Method:  "getname",
+		Input:   Input{Equals: map[string]interface{}{"id": float64(3)}},
+		Output:  Output{Data: map[string]interface{}{"name": "api"}},
+	}))
+
+	require.NoError(t, os.WriteFile(path, []byte(`
+service: user
+method: getname
+input: {equals: {id: 1}}
+output: {data: {name: renamed}}
+`), 0o644))
+	reloadStubFile(path, true)
+
+	names := func() []interface{} {
+		var names []interface{}
+		for _, s := range allStub()["user"]["getname"] {
+			names = append(names, s.Output.Data["name"])
+		}
+		return names
+	}
+	assert.ElementsMatch(t, []interface{}{"renamed", "api"}, names())
+
+	require.NoError(t, os.Remove(path))
+	reloadStubFile(path, false)
+	assert.Equal(t, []interface{}{"api"}, names())
+}
+
+func Test_reloadStubFileAtOnce(t *testing.T) {
+	clearStorage()
+	path := filepath.Join(t.TempDir(), "user.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"service":"user","method":"getname","input":{"equals":{"id":1}},"output":{"data":{"name":"user1"}}}`), 0o644))
+	reloadStubFile(path, true)
+
+	// the stubs of the file are swapped at once, lookups never miss them
+	done := make(chan struct{})
+	missed := make(chan error, 1)
+	go func() {
+		defer close(missed)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if _, err := findStub(&findStubPayload{Service: "user", Method: "getname", Data: map[string]interface{}{"id": float64(1)}}); err != nil {
+				missed <- err
+				return
+			}
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		reloadStubFile(path, true)
+	}
+	close(done)
+	assert.NoError(t, <-missed)
+}
+
+func Test_listStubWhileReloading(t *testing.T) {
+	clearStorage()
+	path := filepath.Join(t.TempDir(), "user.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+  {"service":"user","method":"getname","input":{"equals":{"id":1}},"output":{"data":{"name":"user1"}}},
+  {"service":"user","method":"getage","input":{"equals":{"id":1}},"output":{"data":{"age":1}}}
+]`), 0o644))
+	reloadStubFile(path, true)
+
+	// the listing is encoded while the watcher swaps the stubs of the file
+	listed := make(chan struct{})
+	go func() {
+		defer close(listed)
+		for i := 0; i < 500; i++ {
+			res := httptest.NewRecorder()
+			listStub(res, httptest.NewRequest(http.MethodGet, "/", nil))
+			assert.Equal(t, http.StatusOK, res.Code)
+		}
+	}()
+	for reloading := true; reloading; {
+		select {
+		case <-listed:
+			reloading = false
+		default:
+			reloadStubFile(path, true)
+		}
+	}
+	assert.Len(t, allStub()["user"], 2)
+}
@@ -0,0 +1,226 @@
+package stub
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlErrorLine finds the line yaml reports in its errors, e.g. "yaml: line 3: did not find expected key"
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): `)
+
+// isYAMLFile tells whether a stub file is read as yaml
+func isYAMLFile(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".yaml") || strings.HasSuffix(name, ".yml")
+}
+
+// parseYAMLStubs reads the stubs of a yaml file. every document of the file holds
+// a stub or a list of stubs, with the same fields as the json stubs. anchors, aliases
+// and merge keys are resolved before the stub is read, and mappings whose keys are all
+// hidden are skipped so that they can hold anchors only. it returns the line of each
+// stub along with it, and errors are *loadError with the line they refer to.
+func parseYAMLStubs(path string, byt []byte) ([]*Stub, []int, error) {
+	var (
+		stubs []*Stub
+		lines []int
+	)
+
+	decoder := yaml.NewDecoder(bytes.NewReader(byt))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			loadErr := &loadError{File: path, Reason: strings.TrimPrefix(err.Error(), "yaml: ")}
+			if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+				loadErr.Line, _ = strconv.Atoi(match[1])
+				loadErr.Reason = strings.TrimPrefix(err.Error(), match[0])
+			}
+			return nil, nil, loadErr
+		}
+		if len(doc.Content) == 0 {
+			// empty document, e.g. a file ending with ---
+			continue
+		}
+
+		nodes := []*yaml.Node{doc.Content[0]}
+		if doc.Content[0].Kind == yaml.SequenceNode {
+			nodes = doc.Content[0].Content
+		}
+
+		for _, node := range nodes {
+			if isAnchorHolder(resolveAlias(node)) {
+				continue
+			}
+			stub, line, err := yamlStub(node)
+			if err != nil {
+				index := len(stubs)
+				return nil, nil, &loadError{File: path, Index: &index, Line: line, Reason: err.Error()}
+			}
+			stubs = append(stubs, stub)
+			lines = append(lines, node.Line)
+		}
+	}
+
+	return stubs, lines, nil
+}
+
+// isAnchorHolder tells whether a mapping only holds blocks to share with anchors:
+// it has no stub fields and its keys are hidden, starting with . or x-
+func isAnchorHolder(mapping *yaml.Node) bool {
+	if mapping.Kind != yaml.MappingNode || len(mapping.Content) == 0 {
+		return false
+	}
+	for i := 0; i < len(mapping.Content); i += 2 {
+		key := mapping.Content[i].Value
+		if !strings.HasPrefix(key, ".") && !strings.HasPrefix(key, "x-") {
+			return false
+		}
+	}
+	return true
+}
+
+// yamlStub reads a stub from its node, going through json
+// so that the stub is read exactly like a json one. on error, it returns the line at fault.
+func yamlStub(node *yaml.Node) (*Stub, int, error) {
+	if resolveAlias(node).Kind != yaml.MappingNode {
+		return nil, node.Line, fmt.Errorf("stub must be a mapping")
+	}
+
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, node.Line, err
+	}
+	value, err := jsonValue(value)
+	if err != nil {
+		return nil, node.Line, err
+	}
+	byt, err := json.Marshal(value)
+	if err != nil {
+		return nil, node.Line, err
+	}
+
+	stub := &Stub{}
+	if err := json.Unmarshal(byt, stub); err != nil {
+		line := node.Line
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			line = fieldLine(node, typeErr.Field)
+			err = fmt.Errorf("cannot use %s as %s in field %s", typeErr.Value, typeErr.Type, typeErr.Field)
+		}
+		return nil, line, err
+	}
+	return stub, node.Line, nil
+}
+
+// jsonValue turns the maps yaml decodes with non string keys into json objects
+func jsonValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			val, err := jsonValue(val)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = val
+		}
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			val, err := jsonValue(val)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case string, int, float64, bool:
+				object[fmt.Sprint(key)] = val
+			default:
+				return nil, fmt.Errorf("unsupported key %v", key)
+			}
+		}
+		return object, nil
+	case []interface{}:
+		for i, val := range v {
+			val, err := jsonValue(val)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = val
+		}
+	}
+	return value, nil
+}
+
+// fieldLine finds the line of a field given as a json path such as "output.code",
+// or of its closest parent found in the node
+func fieldLine(node *yaml.Node, field string) int {
+	line := node.Line
+	if field == "" {
+		return line
+	}
+
+	for _, key := range strings.Split(field, ".") {
+		node = resolveAlias(node)
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			next = mappingValue(node, key)
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(node.Content) {
+				next = node.Content[i]
+			}
+		}
+		if next == nil {
+			return line
+		}
+		node = next
+		line = node.Line
+	}
+	return line
+}
+
+// mappingValue returns the value of a key of a mapping node, looking into merged mappings too
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Tag != "!!merge" {
+			continue
+		}
+		merged := resolveAlias(node.Content[i+1])
+		sources := []*yaml.Node{merged}
+		if merged.Kind == yaml.SequenceNode {
+			sources = merged.Content
+		}
+		for _, source := range sources {
+			source = resolveAlias(source)
+			if source.Kind != yaml.MappingNode {
+				continue
+			}
+			if value := mappingValue(source, key); value != nil {
+				return value
+			}
+		}
+	}
+	return nil
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
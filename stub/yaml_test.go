@@ -0,0 +1,140 @@
+package stub
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+func Test_parseYAMLStubs(t *testing.T) {
+	byt := []byte(`# shared outputs
+.found: &found
+  data:
+    name: user1
+    tags: [a, b]
+x-headers: &headers
+  x-id: "1"
+---
+- service: user
+  method: getname
+  input:
+    equals:
+      id: 1
+  output: *found
+- service: user
+  method: getname
+  input:
+    contains: {id: 2}
+  output:
+    <<: *found
+    code: 5
+    error: not found
+    headers: *headers
+---
+service: user
+method: delete
+input:
+  equals: {id: 3}
+output:
+  data: {}
+  delay: 100ms
+`)
+
+	stubs, lines, err := parseYAMLStubs("stubs.yaml", byt)
+	require.NoError(t, err)
+	// the first document has hidden keys only, it holds the anchors
+	require.Len(t, stubs, 3)
+	assert.Equal(t, []int{9, 15, 25}, lines)
+
+	assert.Equal(t, "getname", stubs[0].Method)
+	assert.Equal(t, map[string]interface{}{"id": float64(1)}, stubs[0].Input.Equals)
+	assert.Equal(t, map[string]interface{}{"name": "user1", "tags": []interface{}{"a", "b"}}, stubs[0].Output.Data)
+
+	require.NotNil(t, stubs[1].Output.Code)
+	assert.Equal(t, codes.NotFound, *stubs[1].Output.Code)
+	assert.Equal(t, "user1", stubs[1].Output.Data["name"])
+	assert.Equal(t, map[string]string{"x-id": "1"}, stubs[1].Output.Headers)
+	assert.Equal(t, map[string]interface{}{"id": float64(2)}, stubs[1].Input.Contains)
+
+	require.NotNil(t, stubs[2].Output.Delay)
+	assert.Equal(t, "delete", stubs[2].Method)
+}
+
+func Test_parseYAMLStubsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		wantErr string
+	}{
+		{
+			name:    "syntax",
+			yaml:    "service: user\nmethod: getname\n\tinput: {}\n",
+			wantErr: "stubs.yml:2: found a tab character",
+		},
+		{
+			name:    "not a stub",
+			yaml:    "service: user\n---\n- service: one\n- two\n",
+			wantErr: "stubs.yml:4: stub 2: stub must be a mapping",
+		},
+		{
+			name:    "wrong field type",
+			yaml:    "service: user\nmethod: getname\ninput:\n  equals: {}\noutput:\n  data: {}\n  headers:\n    x-id: [1]\n",
+			wantErr: "stubs.yml:8: stub 0: cannot use array as string in field output.headers.x-id",
+		},
+		{
+			name:    "wrong type in merged mapping",
+			yaml:    "base: &base\n  headers:\n    x-id: [1]\nservice: user\noutput:\n  <<: *base\n",
+			wantErr: "stubs.yml:3: stub 0: cannot use array as string in field output.headers.x-id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseYAMLStubs("stubs.yml", []byte(tt.yaml))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func Test_readStubFromFileYAML(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "user.yaml"), []byte(`
+service: user
+method: getname
+input:
+  equals: {id: 1}
+output:
+  data: {name: user1}
+---
+service: user
+method: getname
+input:
+  equals: {id: 2}
+output:
+  data: {name: user2}
+`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.yml"), []byte("service: [user\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("service: user\n"), 0o644))
+
+	sm := stubMapping{}
+	assert.Equal(t, 2, sm.readStubFromFile(dir))
+	assert.Len(t, sm["user"]["getname"], 2)
+}
+
+func Test_readStubFileYAMLWithoutService(t *testing.T) {
+	clearStorage()
+	clearLoadErrors("")
+	path := filepath.Join(t.TempDir(), "orders.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("servce: order\nmethod: GetOrder\ninput: {equals: {id: 1}}\noutput: {data: {}}\n"), 0o644))
+
+	// a typo isn't taken for an anchor holder
+	_, stored := stubStorage.readStubFile(path)
+	assert.Equal(t, 0, stored)
+	zero := 0
+	assert.Equal(t, []*loadError{{File: path, Index: &zero, Line: 1, Reason: "service name can't be empty"}}, allLoadErrors())
+}